@@ -3,6 +3,7 @@ package ast
 import "monke/token"
 import "bytes"
 import "strings"
+import "sort"
 
 // An interface is a type that defines a set of methods
 type Node interface {
@@ -23,18 +24,33 @@ type Expression interface{
 
 type Program struct {
 	Statements []Statement
+	Slotted bool // whether resolver.AssignSlots has run on the program
 }
 
 // It creates a buffer and writes the return value of each statement's String()
 // method to it and returns the buffer as a string
 func (p *Program) String() string{
-	var out bytes.Buffer //bytes.Buffer creates an empty buffer without any initialization
+	return joinStatements(p.Statements, "")
+}
+
+// joins the statements so that they parse back as the same statements.
+// Let, return and throw statements end in a semicolon already, but an
+// expression statement needs one to keep the next statement from continuing it.
+func joinStatements(stmts []Statement, sep string) string {
+	var out bytes.Buffer
 
-	for _, s := range p.Statements {
-		out.WriteString(s.String()) // writes statements to the buffer
+	for i, s := range stmts {
+		if i > 0 {
+			out.WriteString(sep)
+		}
+		out.WriteString(s.String())
+
+		if _, ok := s.(*ExpressionStatement); ok && i < len(stmts)-1 {
+			out.WriteString(";")
+		}
 	}
 
-	return out.String() // converts the buffer to a string and returns it
+	return out.String()
 }
 func (p *Program) TokenLiteral() string {
 	if len (p.Statements) > 0 {
@@ -78,11 +94,11 @@ func (rs *ReturnStatement) statementNode(){} // for debugging and testing purpos
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal}
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer // empty buffer
-	out.WriteString(rs.TokenLiteral() + " ") // appends 'return' BUFFER: 'return'
+	out.WriteString("return") // appends 'return' BUFFER: 'return'
 
 	// appends {EXPRESSION} BUFFER: 'return {EXPRESSION}'
 	if rs.ReturnValue != nil{
-		out.WriteString(rs.ReturnValue.String())
+		out.WriteString(" " + rs.ReturnValue.String())
 	}
 
 	// appends ';' BUFFER: 'return {EXPRESSION};'
@@ -90,6 +106,37 @@ func (rs *ReturnStatement) String() string {
 	return out.String() // converts buffer to string and returns it
 }
 
+type ThrowStatement struct {
+	Token token.Token // the 'throw' token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(ts.TokenLiteral() + " ")
+
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	}
+
+	out.WriteString(";")
+	return out.String()
+}
+
+// FunctionDeclaration is fn name(params) { }. The function is bound to its
+// name before any statement of the enclosing program or block runs, so it can
+// be called from above where it is declared.
+type FunctionDeclaration struct {
+	Token    token.Token // the 'fn' token
+	Function *FunctionLiteral // with Name set
+}
+
+func (fd *FunctionDeclaration) statementNode()       {}
+func (fd *FunctionDeclaration) TokenLiteral() string { return fd.Token.Literal }
+func (fd *FunctionDeclaration) String() string       { return fd.Function.String() }
+
 type ExpressionStatement struct {
 	Token token.Token
 	Expression Expression
@@ -108,6 +155,17 @@ func (es *ExpressionStatement) String() string {
 type Identifier struct {
 	Token token.Token
 	Value string
+	// where the binding the identifier refers to lives, set by
+	// resolver.AssignSlots. nil for globals, builtins and identifiers it
+	// hasn't seen, which are looked up by name.
+	Slot *Slot
+}
+
+// Slot is a binding's place among the slots of an environment, Depth
+// environments out from the one an identifier is evaluated in.
+type Slot struct {
+	Depth int
+	Index int
 }
 
 // Identifier is an Expression
@@ -184,19 +242,55 @@ func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
 func (ie *IfExpression) String() string{
 	var out bytes.Buffer
 
-	out.WriteString("if")
-	out.WriteString(ie.Condition.String())
-	out.WriteString(" ")
+	out.WriteString("if (")
 	out.WriteString(ie.Condition.String())
+	out.WriteString(") ")
+	out.WriteString(ie.Consequence.String())
 
 	if ie.Alternative != nil {
-		out.WriteString("else ")
+		out.WriteString(" else ")
 		out.WriteString(ie.Alternative.String())
 	}
 
 	return out.String()
 }
 
+// TryExpression needs at least one of Catch and Finally. CatchParam is bound
+// to the caught error inside Catch.
+type TryExpression struct {
+	Token      token.Token // the 'try' token
+	Block      *BlockStatement
+	CatchParam *Identifier
+	Catch      *BlockStatement
+	Finally    *BlockStatement
+	// the names of the slots of the environment Catch runs in, set by
+	// resolver.AssignSlots
+	CatchLocals []string
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+
+	if te.Catch != nil {
+		out.WriteString(" catch (")
+		out.WriteString(te.CatchParam.String())
+		out.WriteString(") ")
+		out.WriteString(te.Catch.String())
+	}
+
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+
+	return out.String()
+}
+
 type BlockStatement struct {
 	Token token.Token
 	Statements []Statement
@@ -205,19 +299,51 @@ type BlockStatement struct {
 func (bs *BlockStatement) statementNode() {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
 func (bs *BlockStatement) String() string {
-	var out bytes.Buffer
-
-	for _, s := range bs.Statements {
-		out.WriteString(s.String())
+	if len(bs.Statements) == 0 {
+		return "{ }"
 	}
-
-	return out.String()
+	return "{ " + joinStatements(bs.Statements, " ") + " }"
 }
 
+// FunctionLiteral is fn(a, b = 1, ...rest) { }. Defaults holds the default
+// value of each parameter, nil for those without one, and is nil if no
+// parameter has a default. Rest collects any arguments after the parameters.
+// Name is only set for the function of a FunctionDeclaration. Locals names
+// the slots of the environment the function runs in, as resolver.AssignSlots
+// laid them out.
 type FunctionLiteral struct {
 	Token token.Token
+	Name *Identifier
 	Parameters []*Identifier
+	Defaults []Expression
+	Rest *Identifier
 	Body *BlockStatement
+	Locals []string
+}
+
+// returns the default value of the i-th parameter, or nil
+func (fl *FunctionLiteral) Default(i int) Expression {
+	if i < len(fl.Defaults) {
+		return fl.Defaults[i]
+	}
+	return nil
+}
+
+// FormatParameters returns a parameter list the way it is written in source,
+// without the parentheses.
+func FormatParameters(params []*Identifier, defaults []Expression, rest *Identifier) string {
+	list := []string{}
+	for i, p := range params {
+		if i < len(defaults) && defaults[i] != nil {
+			list = append(list, p.String()+" = "+defaults[i].String())
+		} else {
+			list = append(list, p.String())
+		}
+	}
+	if rest != nil {
+		list = append(list, "..."+rest.String())
+	}
+	return strings.Join(list, ", ")
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
@@ -225,14 +351,12 @@ func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
-	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
-	}
-
 	out.WriteString(fl.TokenLiteral())
+	if fl.Name != nil {
+		out.WriteString(" " + fl.Name.String())
+	}
 	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(FormatParameters(fl.Parameters, fl.Defaults, fl.Rest))
 	out.WriteString(") ")
 	out.WriteString(fl.Body.String())
 
@@ -270,7 +394,7 @@ type StringLiteral struct{
 
 func (sl *StringLiteral) expressionNode() {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
-func (sl *StringLiteral) String () string { return sl.Token.Literal }
+func (sl *StringLiteral) String () string { return `"` + sl.Value + `"` }
 
 type ArrayLiteral struct {
 	Token token.Token
@@ -324,10 +448,12 @@ func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
+	// maps have no order, so sort the pairs to always print the same thing
 	pairs := []string{}
 	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+		pairs = append(pairs, key.String()+": "+value.String())
 	}
+	sort.Strings(pairs)
 
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
@@ -335,3 +461,14 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+
+type ImportExpression struct {
+	Token token.Token // the 'import' token
+	Path  *StringLiteral
+}
+
+func (ie *ImportExpression) expressionNode()      {}
+func (ie *ImportExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *ImportExpression) String() string {
+	return ie.TokenLiteral() + " " + ie.Path.String()
+}
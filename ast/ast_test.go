@@ -26,3 +26,52 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestStringOfBlocks(t *testing.T) {
+	x := &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x"}, Value: "x"}
+	one := &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1}
+	hello := &StringLiteral{Token: token.Token{Type: token.STRING, Literal: "hello"}, Value: "hello"}
+
+	tests := []struct {
+		node     Node
+		expected string
+	}{
+		{hello, `"hello"`},
+		{
+			&IfExpression{
+				Condition:   x,
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one}}},
+				Alternative: &BlockStatement{},
+			},
+			"if (x) { 1 } else { }",
+		},
+		{
+			&FunctionLiteral{
+				Token:      token.Token{Type: token.FUNCTION, Literal: "fn"},
+				Parameters: []*Identifier{x},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: hello},
+					&ReturnStatement{ReturnValue: x},
+				}},
+			},
+			`fn(x) { "hello"; return x; }`,
+		},
+		{
+			&HashLiteral{Pairs: map[Expression]Expression{hello: one, x: hello}},
+			`{"hello": 1, x: "hello"}`,
+		},
+		{
+			&Program{Statements: []Statement{
+				&ExpressionStatement{Expression: x},
+				&ExpressionStatement{Expression: one},
+			}},
+			"x;1",
+		},
+	}
+
+	for i, tt := range tests {
+		if actual := tt.node.String(); actual != tt.expected {
+			t.Errorf("tests[%d]: String() wrong. expected=%q, got=%q", i, tt.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package ast
+
+// Inspect calls f for node and then, if f returns true, for each of the
+// nodes inside it in the order they appear in the source. Hash literal pairs
+// are visited in no particular order.
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, stmt := range node.Statements {
+			Inspect(stmt, f)
+		}
+	case *LetStatement:
+		Inspect(node.Name, f)
+		inspectExpression(node.Value, f)
+	case *ReturnStatement:
+		inspectExpression(node.ReturnValue, f)
+	case *ThrowStatement:
+		inspectExpression(node.Value, f)
+	case *ExpressionStatement:
+		inspectExpression(node.Expression, f)
+	case *BlockStatement:
+		for _, stmt := range node.Statements {
+			Inspect(stmt, f)
+		}
+	case *PrefixExpression:
+		inspectExpression(node.Right, f)
+	case *InfixExpression:
+		inspectExpression(node.Left, f)
+		inspectExpression(node.Right, f)
+	case *IfExpression:
+		inspectExpression(node.Condition, f)
+		inspectBlock(node.Consequence, f)
+		inspectBlock(node.Alternative, f)
+	case *TryExpression:
+		inspectBlock(node.Block, f)
+		if node.CatchParam != nil {
+			Inspect(node.CatchParam, f)
+		}
+		inspectBlock(node.Catch, f)
+		inspectBlock(node.Finally, f)
+	case *FunctionDeclaration:
+		Inspect(node.Function, f)
+	case *FunctionLiteral:
+		if node.Name != nil {
+			Inspect(node.Name, f)
+		}
+		for i, param := range node.Parameters {
+			Inspect(param, f)
+			inspectExpression(node.Default(i), f)
+		}
+		if node.Rest != nil {
+			Inspect(node.Rest, f)
+		}
+		inspectBlock(node.Body, f)
+	case *CallExpression:
+		inspectExpression(node.Function, f)
+		for _, arg := range node.Arguments {
+			inspectExpression(arg, f)
+		}
+	case *ArrayLiteral:
+		for _, el := range node.Elements {
+			inspectExpression(el, f)
+		}
+	case *IndexExpression:
+		inspectExpression(node.Left, f)
+		inspectExpression(node.Index, f)
+	case *HashLiteral:
+		for key, value := range node.Pairs {
+			inspectExpression(key, f)
+			inspectExpression(value, f)
+		}
+	case *ImportExpression:
+		if node.Path != nil {
+			Inspect(node.Path, f)
+		}
+	}
+}
+
+// nil pointers inside interfaces aren't nil interfaces, so optional parts of
+// nodes are checked before they are passed on
+func inspectExpression(e Expression, f func(Node) bool) {
+	if e != nil {
+		Inspect(e, f)
+	}
+}
+
+func inspectBlock(b *BlockStatement, f func(Node) bool) {
+	if b != nil {
+		Inspect(b, f)
+	}
+}
@@ -0,0 +1,56 @@
+package ast
+
+import (
+	"monke/token"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+
+	// let f = fn(x) { if (x) { return y; } else { } }; f(z)
+	program := &Program{Statements: []Statement{
+		&LetStatement{Name: ident("f"), Value: &FunctionLiteral{
+			Parameters: []*Identifier{ident("x")},
+			Body: &BlockStatement{Statements: []Statement{
+				&ExpressionStatement{Expression: &IfExpression{
+					Condition:   ident("x"),
+					Consequence: &BlockStatement{Statements: []Statement{&ReturnStatement{ReturnValue: ident("y")}}},
+					Alternative: &BlockStatement{},
+				}},
+			}},
+		}},
+		&ExpressionStatement{Expression: &CallExpression{Function: ident("f"), Arguments: []Expression{ident("z")}}},
+	}}
+
+	var names []string
+	Inspect(program, func(n Node) bool {
+		if id, ok := n.(*Identifier); ok {
+			names = append(names, id.Value)
+		}
+		return true
+	})
+
+	expected := []string{"f", "x", "x", "y", "f", "z"}
+	if len(names) != len(expected) {
+		t.Fatalf("visited %v, expected %v", names, expected)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("visited %v, expected %v", names, expected)
+		}
+	}
+
+	// returning false skips whatever is inside the node
+	count := 0
+	Inspect(program, func(n Node) bool {
+		count++
+		_, isFunction := n.(*FunctionLiteral)
+		return !isFunction
+	})
+	if count != 8 {
+		t.Errorf("expected 8 nodes outside the function body, got %d", count)
+	}
+}
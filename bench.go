@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"monke/tester"
+	"os"
+	"time"
+)
+
+// runs the benchmarks in *_test.grr files and reports what their calls cost
+func runBench(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	benchtime := flags.Duration("time", time.Second, "how long to call each benchmark for")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: monke bench [-time duration] [file.grr | directory]...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := tester.Discover(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	status := 0
+	for _, fileName := range files {
+		results, err := tester.BenchFile(fileName, *benchtime)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+		if len(results) == 0 {
+			continue
+		}
+
+		fmt.Println(fileName)
+		tester.WriteBenchmarks(os.Stdout, results)
+		for _, r := range results {
+			if r.Failure != nil {
+				status = 1
+			}
+		}
+	}
+	return status
+}
@@ -0,0 +1,172 @@
+// Package coverage turns the statement counts an interpreter records into
+// reports of which lines, branches and functions of a program ran, as text,
+// an annotated HTML page or LCOV tracefiles.
+package coverage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"monke/ast"
+	"monke/evaluator"
+	"monke/lexer"
+	"monke/parser"
+	"monke/token"
+	"sort"
+)
+
+// File is the coverage of one source file.
+type File struct {
+	Name       string
+	Source     string
+	Statements []Statement
+	Branches   []Branch
+	Functions  []Function
+}
+
+// Statement is how often one statement ran.
+type Statement struct {
+	Pos   token.Position
+	Count int
+}
+
+// Branch is how often each way through an if was taken. An if without an
+// else still has two ways through it.
+type Branch struct {
+	Pos     token.Position // of the 'if'
+	Count   int            // times the condition was evaluated
+	Then    int
+	Else    int
+	HasElse bool
+}
+
+// Function is how often one function was called.
+type Function struct {
+	Name  string // "(anonymous line:column)" for functions without a name
+	Pos   token.Position
+	Calls int
+}
+
+// Build reads and parses files and every other file c has counts for, and
+// returns their coverage sorted by name. Counts recorded outside of any file
+// are left out.
+func Build(c *evaluator.Coverage, files []string) ([]*File, error) {
+	names := make(map[string]bool)
+	for _, name := range files {
+		names[name] = true
+	}
+	for name := range c.Files {
+		if name != "" {
+			names[name] = true
+		}
+	}
+
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var result []*File
+	for _, name := range sorted {
+		source, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		fc, ok := c.Files[name]
+		if !ok {
+			fc = &evaluator.FileCoverage{}
+		}
+		f, err := NewFile(name, string(source), fc)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, f)
+	}
+	return result, nil
+}
+
+// NewFile matches the counts in fc with the statements, ifs and functions of
+// source.
+func NewFile(name, source string, fc *evaluator.FileCoverage) (*File, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s: %s", name, p.Errors()[0])
+	}
+
+	f := &File{Name: name, Source: source}
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			f.statement(node.Token.Pos, fc)
+		case *ast.ReturnStatement:
+			f.statement(node.Token.Pos, fc)
+		case *ast.ThrowStatement:
+			f.statement(node.Token.Pos, fc)
+		case *ast.FunctionDeclaration:
+			f.statement(node.Token.Pos, fc)
+		case *ast.ExpressionStatement:
+			f.statement(node.Token.Pos, fc)
+		case *ast.IfExpression:
+			b := Branch{
+				Pos:   node.Token.Pos,
+				Count: fc.Ifs[node.Token.Pos.Offset],
+				Then:  fc.Blocks[node.Consequence.Token.Pos.Offset],
+			}
+			if node.Alternative != nil {
+				b.HasElse = true
+				b.Else = fc.Blocks[node.Alternative.Token.Pos.Offset]
+			} else {
+				b.Else = b.Count - b.Then
+			}
+			f.Branches = append(f.Branches, b)
+		case *ast.FunctionLiteral:
+			name := fmt.Sprintf("(anonymous %d:%d)", node.Token.Pos.Line, node.Token.Pos.Column)
+			if node.Name != nil {
+				name = node.Name.Value
+			}
+			f.Functions = append(f.Functions, Function{
+				Name:  name,
+				Pos:   node.Token.Pos,
+				Calls: fc.Blocks[node.Body.Token.Pos.Offset],
+			})
+		}
+		return true
+	})
+	return f, nil
+}
+
+func (f *File) statement(pos token.Position, fc *evaluator.FileCoverage) {
+	f.Statements = append(f.Statements, Statement{Pos: pos, Count: fc.Statements[pos.Offset]})
+}
+
+// Lines returns how often each line with statements on it ran, which is how
+// often the statement on it that ran most did.
+func (f *File) Lines() map[int]int {
+	lines := make(map[int]int)
+	for _, s := range f.Statements {
+		if count, ok := lines[s.Pos.Line]; !ok || s.Count > count {
+			lines[s.Pos.Line] = s.Count
+		}
+	}
+	return lines
+}
+
+// Covered returns how many statements and ways through ifs ran at least once,
+// along with how many there are.
+func (f *File) Covered() (statements, totalStatements, branches, totalBranches int) {
+	for _, s := range f.Statements {
+		if s.Count > 0 {
+			statements++
+		}
+	}
+	for _, b := range f.Branches {
+		if b.Then > 0 {
+			branches++
+		}
+		if b.Else > 0 {
+			branches++
+		}
+	}
+	return statements, len(f.Statements), branches, 2 * len(f.Branches)
+}
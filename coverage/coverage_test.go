@@ -0,0 +1,131 @@
+package coverage
+
+import (
+	"io/ioutil"
+	"monke/evaluator"
+	"monke/lexer"
+	"monke/object"
+	"monke/parser"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const SOURCE = `fn sign(n) {
+  if (n < 0) {
+    return -1
+  }
+  1
+}
+let twice = fn(f, x) { f(f(x)) };
+let unused = fn() { 0 };
+sign(twice(sign, 2));
+if (true) { 1 } else { 2 }
+`
+
+// runs source as the file name and returns what ran
+func run(t *testing.T, name, source string) *evaluator.Coverage {
+	t.Helper()
+	in := evaluator.New()
+	in.File = name
+	in.StartCoverage()
+	program := parser.New(lexer.New(source)).ParseProgram()
+	in.Eval(program, object.NewEnvironment())
+	return in.StopCoverage()
+}
+
+func TestNewFile(t *testing.T) {
+	c := run(t, "main.grr", SOURCE)
+	f, err := NewFile("main.grr", SOURCE, c.File("main.grr"))
+	if err != nil {
+		t.Fatalf("NewFile returned error: %s", err)
+	}
+
+	lines := map[int]int{1: 1, 2: 3, 3: 0, 5: 3, 7: 1, 8: 1, 9: 1, 10: 1}
+	got := f.Lines()
+	if len(got) != len(lines) {
+		t.Errorf("wrong lines. want=%v, got=%v", lines, got)
+	}
+	for line, count := range lines {
+		if got[line] != count {
+			t.Errorf("line %d ran %d times, want %d", line, got[line], count)
+		}
+	}
+
+	branches := []Branch{
+		{Count: 3, Then: 0, Else: 3, HasElse: false},
+		{Count: 1, Then: 1, Else: 0, HasElse: true},
+	}
+	if len(f.Branches) != len(branches) {
+		t.Fatalf("wrong number of branches. want=%d, got=%d", len(branches), len(f.Branches))
+	}
+	for i, want := range branches {
+		b := f.Branches[i]
+		b.Pos = want.Pos
+		if b != want {
+			t.Errorf("branches[%d] - want=%+v, got=%+v", i, want, b)
+		}
+	}
+
+	functions := []struct {
+		name  string
+		line  int
+		calls int
+	}{
+		{"sign", 1, 3},
+		{"(anonymous 7:13)", 7, 1},
+		{"(anonymous 8:14)", 8, 0},
+	}
+	if len(f.Functions) != len(functions) {
+		t.Fatalf("wrong number of functions. want=%d, got=%d", len(functions), len(f.Functions))
+	}
+	for i, want := range functions {
+		fn := f.Functions[i]
+		if fn.Name != want.name || fn.Pos.Line != want.line || fn.Calls != want.calls {
+			t.Errorf("functions[%d] - want=%+v, got=%+v", i, want, fn)
+		}
+	}
+
+	statements, totalStatements, covered, totalBranches := f.Covered()
+	if statements != 9 || totalStatements != 12 || covered != 2 || totalBranches != 4 {
+		t.Errorf("wrong totals. statements=%d/%d branches=%d/%d",
+			statements, totalStatements, covered, totalBranches)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "coverage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	main := filepath.Join(dir, "main.grr")
+	other := filepath.Join(dir, "other.grr")
+	if err := ioutil.WriteFile(main, []byte("let x = 1;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(other, []byte("x + 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := run(t, other, "x + 1")
+	c.File("")
+	files, err := Build(c, []string{main})
+	if err != nil {
+		t.Fatalf("Build returned error: %s", err)
+	}
+	if len(files) != 2 || files[0].Name != main || files[1].Name != other {
+		t.Fatalf("wrong files: %v", files)
+	}
+	if s, _, _, _ := files[0].Covered(); s != 0 {
+		t.Errorf("nothing ran in main.grr, got %d statements", s)
+	}
+	if s, _, _, _ := files[1].Covered(); s != 1 {
+		t.Errorf("other.grr ran 1 statement, got %d", s)
+	}
+
+	if _, err := Build(c, []string{filepath.Join(dir, "missing.grr")}); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,217 @@
+package coverage
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WriteText writes how much of each file ran, followed by the lines that
+// didn't run and the ways through ifs that weren't taken.
+func WriteText(w io.Writer, files []*File) error {
+	var statements, totalStatements, branches, totalBranches int
+	for _, f := range files {
+		s, ts, b, tb := f.Covered()
+		statements, totalStatements = statements+s, totalStatements+ts
+		branches, totalBranches = branches+b, totalBranches+tb
+
+		fmt.Fprintf(w, "%s: %s of statements (%d/%d), %s of branches (%d/%d)\n",
+			f.Name, percent(s, ts), s, ts, percent(b, tb), b, tb)
+
+		var notRun []int
+		for line, count := range f.Lines() {
+			if count == 0 {
+				notRun = append(notRun, line)
+			}
+		}
+		if len(notRun) > 0 {
+			sort.Ints(notRun)
+			fmt.Fprintf(w, "  not run: %s\n", lineRanges(notRun))
+		}
+
+		var notTaken []string
+		for _, b := range f.Branches {
+			if b.Then == 0 {
+				notTaken = append(notTaken, fmt.Sprintf("%d:%d then", b.Pos.Line, b.Pos.Column))
+			}
+			if b.Else == 0 {
+				notTaken = append(notTaken, fmt.Sprintf("%d:%d else", b.Pos.Line, b.Pos.Column))
+			}
+		}
+		if len(notTaken) > 0 {
+			fmt.Fprintf(w, "  not taken: %s\n", strings.Join(notTaken, ", "))
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "total: %s of statements (%d/%d), %s of branches (%d/%d)\n",
+		percent(statements, totalStatements), statements, totalStatements,
+		percent(branches, totalBranches), branches, totalBranches)
+	return err
+}
+
+// formats part of total as a percentage. Nothing out of nothing is all of it.
+func percent(part, total int) string {
+	if total == 0 {
+		return "100.0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(part)*100/float64(total))
+}
+
+// joins sorted line numbers, collapsing consecutive ones into ranges
+func lineRanges(lines []int) string {
+	var parts []string
+	for i := 0; i < len(lines); {
+		j := i
+		for j+1 < len(lines) && lines[j+1] == lines[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(lines[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", lines[i], lines[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ", ")
+}
+
+// WriteLCOV writes the coverage of files as an LCOV tracefile, which genhtml
+// and most editors and CI services read.
+func WriteLCOV(w io.Writer, files []*File) error {
+	for _, f := range files {
+		name, err := filepath.Abs(f.Name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "TN:\nSF:%s\n", name)
+
+		hit := 0
+		for _, fn := range f.Functions {
+			fmt.Fprintf(w, "FN:%d,%s\n", fn.Pos.Line, fn.Name)
+		}
+		for _, fn := range f.Functions {
+			fmt.Fprintf(w, "FNDA:%d,%s\n", fn.Calls, fn.Name)
+			if fn.Calls > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(w, "FNF:%d\nFNH:%d\n", len(f.Functions), hit)
+
+		hit = 0
+		for i, b := range f.Branches {
+			for j, taken := range []int{b.Then, b.Else} {
+				// branches of ifs that never ran are "-" rather than 0
+				count := "-"
+				if b.Count > 0 {
+					count = strconv.Itoa(taken)
+				}
+				fmt.Fprintf(w, "BRDA:%d,%d,%d,%s\n", b.Pos.Line, i, j, count)
+				if taken > 0 {
+					hit++
+				}
+			}
+		}
+		fmt.Fprintf(w, "BRF:%d\nBRH:%d\n", 2*len(f.Branches), hit)
+
+		lines := f.Lines()
+		var numbers []int
+		for line := range lines {
+			numbers = append(numbers, line)
+		}
+		sort.Ints(numbers)
+		hit = 0
+		for _, line := range numbers {
+			fmt.Fprintf(w, "DA:%d,%d\n", line, lines[line])
+			if lines[line] > 0 {
+				hit++
+			}
+		}
+		if _, err := fmt.Fprintf(w, "LF:%d\nLH:%d\nend_of_record\n", len(numbers), hit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// htmlLine is one line of source in the HTML report
+type htmlLine struct {
+	Number int
+	Count  string // empty for lines without statements
+	Class  string // "run", "not-run" or "partial" for an if not taken both ways
+	Text   string
+}
+
+type htmlFile struct {
+	Name    string
+	Summary string
+	Lines   []htmlLine
+}
+
+var htmlReport = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Monke coverage</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; font-family: monospace; }
+td { padding: 0 0.5em; white-space: pre; vertical-align: top; }
+td.number, td.count { text-align: right; color: #888; }
+tr.run td.text { background: #dfd; }
+tr.not-run td.text { background: #fdd; }
+tr.partial td.text { background: #ffc; }
+</style>
+</head>
+<body>
+{{range .}}<h2>{{.Name}}</h2>
+<p>{{.Summary}}</p>
+<table>
+{{range .Lines}}<tr class="{{.Class}}"><td class="number">{{.Number}}</td><td class="count">{{.Count}}</td><td class="text">{{.Text}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+// WriteHTML writes a page with the source of each file, every line marked
+// with how often it ran.
+func WriteHTML(w io.Writer, files []*File) error {
+	var page []htmlFile
+	for _, f := range files {
+		s, ts, b, tb := f.Covered()
+		hf := htmlFile{
+			Name: f.Name,
+			Summary: fmt.Sprintf("%s of statements (%d/%d), %s of branches (%d/%d)",
+				percent(s, ts), s, ts, percent(b, tb), b, tb),
+		}
+
+		partial := make(map[int]bool)
+		for _, b := range f.Branches {
+			if b.Then == 0 || b.Else == 0 {
+				partial[b.Pos.Line] = true
+			}
+		}
+
+		lines := f.Lines()
+		for i, text := range strings.Split(f.Source, "\n") {
+			line := htmlLine{Number: i + 1, Text: text}
+			if count, ok := lines[i+1]; ok {
+				line.Count = strconv.Itoa(count)
+				switch {
+				case count == 0:
+					line.Class = "not-run"
+				case partial[i+1]:
+					line.Class = "partial"
+				default:
+					line.Class = "run"
+				}
+			}
+			hf.Lines = append(hf.Lines, line)
+		}
+		page = append(page, hf)
+	}
+	return htmlReport.Execute(w, page)
+}
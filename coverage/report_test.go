@@ -0,0 +1,113 @@
+package coverage
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// the coverage of SOURCE
+func sourceFile(t *testing.T) *File {
+	t.Helper()
+	c := run(t, "main.grr", SOURCE)
+	f, err := NewFile("main.grr", SOURCE, c.File("main.grr"))
+	if err != nil {
+		t.Fatalf("NewFile returned error: %s", err)
+	}
+	return f
+}
+
+func TestWriteText(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteText(&out, []*File{sourceFile(t)}); err != nil {
+		t.Fatalf("WriteText returned error: %s", err)
+	}
+
+	expected := `main.grr: 75.0% of statements (9/12), 50.0% of branches (2/4)
+  not run: 3
+  not taken: 2:3 then, 10:1 else
+total: 75.0% of statements (9/12), 50.0% of branches (2/4)
+`
+	if out.String() != expected {
+		t.Errorf("wrong report. want=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestLineRanges(t *testing.T) {
+	tests := []struct {
+		lines    []int
+		expected string
+	}{
+		{[]int{3}, "3"},
+		{[]int{1, 2, 3}, "1-3"},
+		{[]int{1, 3, 4, 7}, "1, 3-4, 7"},
+	}
+
+	for _, tt := range tests {
+		if got := lineRanges(tt.lines); got != tt.expected {
+			t.Errorf("lineRanges(%v) - want=%q, got=%q", tt.lines, tt.expected, got)
+		}
+	}
+}
+
+func TestWriteLCOV(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteLCOV(&out, []*File{sourceFile(t)}); err != nil {
+		t.Fatalf("WriteLCOV returned error: %s", err)
+	}
+
+	name, _ := filepath.Abs("main.grr")
+	expected := `TN:
+SF:` + name + `
+FN:1,sign
+FN:7,(anonymous 7:13)
+FN:8,(anonymous 8:14)
+FNDA:3,sign
+FNDA:1,(anonymous 7:13)
+FNDA:0,(anonymous 8:14)
+FNF:3
+FNH:2
+BRDA:2,0,0,0
+BRDA:2,0,1,3
+BRDA:10,1,0,1
+BRDA:10,1,1,0
+BRF:4
+BRH:2
+DA:1,1
+DA:2,3
+DA:3,0
+DA:5,3
+DA:7,1
+DA:8,1
+DA:9,1
+DA:10,1
+LF:8
+LH:7
+end_of_record
+`
+	if out.String() != expected {
+		t.Errorf("wrong tracefile. want=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteHTML(&out, []*File{sourceFile(t)}); err != nil {
+		t.Fatalf("WriteHTML returned error: %s", err)
+	}
+	html := out.String()
+
+	for _, want := range []string{
+		`<h2>main.grr</h2>`,
+		`<p>75.0% of statements (9/12), 50.0% of branches (2/4)</p>`,
+		`<tr class="run"><td class="number">1</td><td class="count">1</td><td class="text">fn sign(n) {</td></tr>`,
+		`<tr class="partial"><td class="number">2</td><td class="count">3</td><td class="text">  if (n &lt; 0) {</td></tr>`,
+		`<tr class="not-run"><td class="number">3</td><td class="count">0</td><td class="text">    return -1</td></tr>`,
+		`<tr class=""><td class="number">4</td><td class="count"></td><td class="text">  }</td></tr>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("the page is missing %q:\n%s", want, html)
+		}
+	}
+}
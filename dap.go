@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"monke/dap"
+	"os"
+)
+
+// serves the debug adapter protocol over stdin and stdout
+func runDAP(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: monke dap")
+		return 2
+	}
+
+	if err := dap.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
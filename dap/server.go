@@ -0,0 +1,436 @@
+// Package dap implements the Debug Adapter Protocol on top of the debugger
+// package, so editors can debug Monke programs.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"monke/ast"
+	"monke/debugger"
+	"monke/evaluator"
+	"monke/lexer"
+	"monke/object"
+	"monke/parser"
+	"net/textproto"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Server debugs one program for a client. The program runs on a goroutine of
+// its own once the client has launched it and finished configuring, and the
+// server answers questions about it whenever it is stopped.
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	writeMu sync.Mutex // guards out and seq
+	seq     int
+
+	// breakpoints set before launch, by file
+	breakpoints map[string][]int
+	launched    bool
+	configured  bool
+	started     bool
+
+	interp   *evaluator.Interpreter
+	debugger *debugger.Debugger
+	program  *ast.Program
+
+	mu     sync.Mutex // guards paused and refs
+	paused bool
+	resume chan struct{}
+	// the values the client can ask for the variables of, while stopped. A
+	// variablesReference is an index into it plus one.
+	refs []interface{}
+}
+
+// creates a new Server reading requests from in and writing to out
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:          bufio.NewReader(in),
+		out:         out,
+		breakpoints: make(map[string][]int),
+		resume:      make(chan struct{}),
+	}
+}
+
+// Serve handles requests until the client disconnects or closes the stream.
+func (s *Server) Serve() error {
+	for {
+		msg, err := s.readMessage()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(msg, &req); err != nil {
+			return fmt.Errorf("invalid message: %s", err)
+		}
+
+		body, err := s.handle(req)
+		if err != nil {
+			s.send(&response{Type: "response", RequestSeq: req.Seq, Command: req.Command, Message: err.Error()})
+		} else {
+			s.send(&response{Type: "response", RequestSeq: req.Seq, Success: true, Command: req.Command, Body: body})
+		}
+
+		switch req.Command {
+		case "initialize":
+			s.sendEvent("initialized", nil)
+		case "launch", "configurationDone":
+			s.start()
+		case "continue", "next", "stepIn", "stepOut", "terminate":
+			s.resumeProgram()
+		case "disconnect":
+			s.resumeProgram()
+			return nil
+		}
+	}
+}
+
+func (s *Server) handle(req request) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return Capabilities{SupportsConfigurationDoneRequest: true, SupportsTerminateRequest: true}, nil
+	case "launch":
+		var args LaunchArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return nil, s.launch(args)
+	case "configurationDone":
+		s.configured = true
+		return nil, nil
+	case "setBreakpoints":
+		var args SetBreakpointsArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(args), nil
+	case "threads":
+		return map[string]interface{}{"threads": []Thread{{ID: THREAD_ID, Name: "main"}}}, nil
+	}
+
+	// the rest are about the program and need it to be stopped
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch req.Command {
+	case "stackTrace":
+		var args StackTraceArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.stackTrace(args), nil
+	case "scopes":
+		var args ScopesArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.scopes(args)
+	case "variables":
+		var args VariablesArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.variables(args)
+	case "continue":
+		return map[string]interface{}{"allThreadsContinued": true}, s.step((*debugger.Debugger).Continue)
+	case "next":
+		return nil, s.step((*debugger.Debugger).StepOver)
+	case "stepIn":
+		return nil, s.step((*debugger.Debugger).StepInto)
+	case "stepOut":
+		return nil, s.step((*debugger.Debugger).StepOut)
+	case "terminate", "disconnect":
+		// a running program stops at its next statement, a paused one once
+		// it's resumed below
+		if s.debugger != nil {
+			s.debugger.Quit()
+		}
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unsupported request %q", req.Command)
+}
+
+// loads the program to debug. It starts running once the client is done
+// configuring.
+func (s *Server) launch(args LaunchArguments) error {
+	if s.launched {
+		return fmt.Errorf("already launched")
+	}
+
+	file, err := filepath.Abs(args.Program)
+	if err != nil {
+		return err
+	}
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		errors := []string{}
+		for _, d := range p.Diagnostics() {
+			errors = append(errors, d.String())
+		}
+		return fmt.Errorf("%s: %s", args.Program, strings.Join(errors, "; "))
+	}
+
+	// stdin and stdout carry the protocol, so the program gets no input and
+	// its output is sent as events
+	in := evaluator.New()
+	in.Stdin = strings.NewReader("")
+	in.Stdout = &outputWriter{s, "stdout"}
+	in.Stderr = &outputWriter{s, "stderr"}
+	in.Dir = filepath.Dir(file)
+	in.File = file
+
+	s.interp = in
+	s.program = program
+	s.debugger = debugger.New(in, args.StopOnEntry)
+	s.debugger.OnStop = s.stopped
+	for file, lines := range s.breakpoints {
+		s.debugger.SetBreakpoints(file, lines)
+	}
+	s.launched = true
+	return nil
+}
+
+// runs the program once it has been launched and configured
+func (s *Server) start() {
+	if !s.launched || !s.configured || s.started {
+		return
+	}
+	s.started = true
+
+	go func() {
+		result, finished := s.debugger.Run(s.program, object.NewEnvironment())
+		if finished {
+			code := 0
+			if err, ok := result.(*object.Error); ok {
+				io.WriteString(s.interp.Stderr, err.Inspect()+"\n")
+				code = 1
+			}
+			s.sendEvent("exited", ExitedEventBody{ExitCode: code})
+		}
+		s.sendEvent("terminated", nil)
+	}()
+}
+
+func (s *Server) setBreakpoints(args SetBreakpointsArguments) interface{} {
+	lines := []int{}
+	breakpoints := []Breakpoint{}
+	for _, bp := range args.Breakpoints {
+		lines = append(lines, bp.Line)
+		breakpoints = append(breakpoints, Breakpoint{Verified: true, Line: bp.Line, Source: args.Source})
+	}
+
+	s.breakpoints[args.Source.Path] = lines
+	if s.debugger != nil {
+		s.debugger.SetBreakpoints(args.Source.Path, lines)
+	}
+
+	return map[string]interface{}{"breakpoints": breakpoints}
+}
+
+// called on the program's goroutine every time it stops. It tells the client
+// and waits for it to say how to go on.
+func (s *Server) stopped(stop debugger.Stop) {
+	s.mu.Lock()
+	s.paused = true
+	s.mu.Unlock()
+
+	s.sendEvent("stopped", StoppedEventBody{Reason: stop.Reason, ThreadID: THREAD_ID, AllThreadsStopped: true})
+	<-s.resume
+}
+
+// sets how the program runs on once it's resumed. The caller holds mu.
+func (s *Server) step(how func(d *debugger.Debugger)) error {
+	if !s.paused {
+		return fmt.Errorf("the program is not stopped")
+	}
+	how(s.debugger)
+	return nil
+}
+
+// lets the program go on after a request has decided how it should
+func (s *Server) resumeProgram() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.paused && s.debugger != nil {
+		s.paused = false
+		s.refs = nil
+		s.resume <- struct{}{}
+	}
+}
+
+func (s *Server) stackTrace(args StackTraceArguments) interface{} {
+	frames := []StackFrame{}
+	if s.paused {
+		for i, frame := range s.debugger.Stack() {
+			frames = append(frames, StackFrame{
+				ID:     i + 1,
+				Name:   frame.Name,
+				Source: Source{Name: filepath.Base(frame.File), Path: frame.File},
+				Line:   frame.Pos.Line,
+				Column: frame.Pos.Column,
+			})
+		}
+	}
+
+	total := len(frames)
+	if args.StartFrame > 0 && args.StartFrame <= len(frames) {
+		frames = frames[args.StartFrame:]
+	}
+	if args.Levels > 0 && args.Levels < len(frames) {
+		frames = frames[:args.Levels]
+	}
+
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": total}
+}
+
+// lists the environments visible from a frame, innermost first
+func (s *Server) scopes(args ScopesArguments) (interface{}, error) {
+	if !s.paused {
+		return nil, fmt.Errorf("the program is not stopped")
+	}
+	stack := s.debugger.Stack()
+	if args.FrameID < 1 || args.FrameID > len(stack) {
+		return nil, fmt.Errorf("no frame %d", args.FrameID)
+	}
+
+	scopes := []Scope{}
+	for env := stack[args.FrameID-1].Env; env != nil; env = env.Outer() {
+		name := "Closure"
+		switch {
+		case env.Outer() == nil:
+			name = "Globals"
+		case len(scopes) == 0:
+			name = "Locals"
+		}
+		scopes = append(scopes, Scope{Name: name, VariablesReference: s.reference(env)})
+	}
+
+	return map[string]interface{}{"scopes": scopes}, nil
+}
+
+// lists the bindings of an environment or the contents of an array or hash
+func (s *Server) variables(args VariablesArguments) (interface{}, error) {
+	if args.VariablesReference < 1 || args.VariablesReference > len(s.refs) {
+		return nil, fmt.Errorf("no variables %d", args.VariablesReference)
+	}
+
+	vars := []Variable{}
+	switch value := s.refs[args.VariablesReference-1].(type) {
+	case *object.Environment:
+		for _, v := range debugger.Variables(value) {
+			vars = append(vars, s.variable(v.Name, v.Value))
+		}
+	case *object.Array:
+		for i, el := range value.Elements {
+			vars = append(vars, s.variable("["+strconv.Itoa(i)+"]", el))
+		}
+	case *object.Hash:
+		pairs := []object.HashPair{}
+		for _, pair := range value.Pairs {
+			pairs = append(pairs, pair)
+		}
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key.Inspect() < pairs[j].Key.Inspect() })
+		for _, pair := range pairs {
+			vars = append(vars, s.variable(pair.Key.Inspect(), pair.Value))
+		}
+	}
+
+	return map[string]interface{}{"variables": vars}, nil
+}
+
+// describes a value, giving arrays and hashes with contents a reference the
+// client can expand them with
+func (s *Server) variable(name string, value object.Object) Variable {
+	v := Variable{Name: name, Value: value.Inspect(), Type: string(value.Type())}
+	switch value := value.(type) {
+	case *object.Array:
+		if len(value.Elements) > 0 {
+			v.VariablesReference = s.reference(value)
+		}
+	case *object.Hash:
+		if len(value.Pairs) > 0 {
+			v.VariablesReference = s.reference(value)
+		}
+	}
+	return v
+}
+
+func (s *Server) reference(value interface{}) int {
+	s.refs = append(s.refs, value)
+	return len(s.refs)
+}
+
+// outputWriter sends what the program writes to the client as output events
+type outputWriter struct {
+	s        *Server
+	category string
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.s.sendEvent("output", OutputEventBody{Category: w.category, Output: string(p)})
+	return len(p), nil
+}
+
+// reads one message framed by a Content-Length header
+func (s *Server) readMessage() ([]byte, error) {
+	headers, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(strings.TrimSpace(headers.Get("Content-Length")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %q", headers.Get("Content-Length"))
+	}
+
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(s.in, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (s *Server) sendEvent(name string, body interface{}) {
+	s.send(&event{Type: "event", Event: name, Body: body})
+}
+
+// numbers msg and writes it. Both the server and the program's goroutine
+// send messages, so this is the one place that writes to out.
+func (s *Server) send(msg interface{}) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.seq++
+	switch msg := msg.(type) {
+	case *response:
+		msg.Seq = s.seq
+	case *event:
+		msg.Seq = s.seq
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
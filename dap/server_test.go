@@ -0,0 +1,350 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const PROGRAM = `let fact = fn(n) {
+  if (n < 2) { return 1 };
+  let rest = fact(n - 1);
+  n * rest
+};
+let data = {"xs": [1, 2], "name": "monke"};
+puts(fact(3));
+`
+
+// client talks to a server running on its own goroutine
+type client struct {
+	t        *testing.T
+	w        io.Writer
+	seq      int
+	messages chan map[string]interface{}
+	// events that arrived while waiting for something else
+	events []map[string]interface{}
+	done   chan error
+}
+
+func newClient(t *testing.T) *client {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+
+	c := &client{
+		t:        t,
+		w:        inW,
+		messages: make(chan map[string]interface{}, 100),
+		done:     make(chan error, 1),
+	}
+
+	go func() {
+		c.done <- NewServer(inR, outW).Serve()
+		outW.Close()
+	}()
+
+	go func() {
+		reader := &Server{in: bufio.NewReader(outR)}
+		for {
+			msg, err := reader.readMessage()
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			var decoded map[string]interface{}
+			if err := json.Unmarshal(msg, &decoded); err != nil {
+				t.Errorf("server sent invalid JSON %q: %s", msg, err)
+			}
+			c.messages <- decoded
+		}
+	}()
+
+	return c
+}
+
+func (c *client) next() map[string]interface{} {
+	c.t.Helper()
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			c.t.Fatalf("server closed the stream")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("timed out waiting for the server")
+	}
+	return nil
+}
+
+// sends a request and returns the response to it
+func (c *client) request(command string, arguments interface{}) map[string]interface{} {
+	c.t.Helper()
+
+	c.seq++
+	data, _ := json.Marshal(map[string]interface{}{
+		"seq": c.seq, "type": "request", "command": command, "arguments": arguments,
+	})
+	fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+
+	for {
+		msg := c.next()
+		if msg["type"] == "response" && msg["request_seq"] == float64(c.seq) {
+			return msg
+		}
+		c.events = append(c.events, msg)
+	}
+}
+
+// waits for the event called name and returns its body
+func (c *client) event(name string) map[string]interface{} {
+	c.t.Helper()
+
+	for i, msg := range c.events {
+		if msg["event"] == name {
+			c.events = append(c.events[:i], c.events[i+1:]...)
+			body, _ := msg["body"].(map[string]interface{})
+			return body
+		}
+	}
+	for {
+		msg := c.next()
+		if msg["type"] == "event" && msg["event"] == name {
+			body, _ := msg["body"].(map[string]interface{})
+			return body
+		}
+		c.events = append(c.events, msg)
+	}
+}
+
+func body(t *testing.T, response map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	if response["success"] != true {
+		t.Fatalf("%s failed: %v", response["command"], response["message"])
+	}
+	b, _ := response["body"].(map[string]interface{})
+	return b
+}
+
+func writeProgram(t *testing.T, source string) string {
+	dir, err := ioutil.TempDir("", "dap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "fact.grr")
+	if err := ioutil.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// starts a session on the test program with breakpoints on the given lines
+func launch(t *testing.T, stopOnEntry bool, lines ...int) (*client, string) {
+	return launchSource(t, PROGRAM, stopOnEntry, lines...)
+}
+
+func launchSource(t *testing.T, source string, stopOnEntry bool, lines ...int) (*client, string) {
+	path := writeProgram(t, source)
+	c := newClient(t)
+
+	caps := body(t, c.request("initialize", map[string]interface{}{"adapterID": "monke"}))
+	if caps["supportsConfigurationDoneRequest"] != true {
+		t.Errorf("unexpected capabilities %v", caps)
+	}
+	c.event("initialized")
+
+	body(t, c.request("launch", LaunchArguments{Program: path, StopOnEntry: stopOnEntry}))
+
+	breakpoints := []SourceBreakpoint{}
+	for _, line := range lines {
+		breakpoints = append(breakpoints, SourceBreakpoint{Line: line})
+	}
+	set := body(t, c.request("setBreakpoints", SetBreakpointsArguments{Source: Source{Path: path}, Breakpoints: breakpoints}))
+	if got := len(set["breakpoints"].([]interface{})); got != len(lines) {
+		t.Errorf("expected %d breakpoints, got %d", len(lines), got)
+	}
+
+	body(t, c.request("configurationDone", nil))
+	return c, path
+}
+
+func stackLines(t *testing.T, c *client) []string {
+	t.Helper()
+	var lines []string
+	frames := body(t, c.request("stackTrace", StackTraceArguments{ThreadID: THREAD_ID}))["stackFrames"].([]interface{})
+	for _, f := range frames {
+		frame := f.(map[string]interface{})
+		lines = append(lines, fmt.Sprintf("%s:%v", frame["name"], frame["line"]))
+	}
+	return lines
+}
+
+func TestBreakpointsAndStack(t *testing.T) {
+	c, path := launch(t, false, 3)
+
+	if reason := c.event("stopped")["reason"]; reason != "breakpoint" {
+		t.Errorf("expected to stop at a breakpoint, stopped for %v", reason)
+	}
+
+	threads := body(t, c.request("threads", nil))["threads"].([]interface{})
+	if len(threads) != 1 {
+		t.Errorf("expected one thread, got %v", threads)
+	}
+
+	if got := fmt.Sprint(stackLines(t, c)); got != "[fact:3 <top level>:7]" {
+		t.Errorf("wrong stack %s", got)
+	}
+
+	body(t, c.request("continue", map[string]interface{}{"threadId": THREAD_ID}))
+	c.event("stopped")
+	if got := fmt.Sprint(stackLines(t, c)); got != "[fact:3 fact:3 <top level>:7]" {
+		t.Errorf("wrong stack %s", got)
+	}
+
+	// clearing the breakpoint lets the program run to the end
+	body(t, c.request("setBreakpoints", SetBreakpointsArguments{Source: Source{Path: path}}))
+	body(t, c.request("continue", map[string]interface{}{"threadId": THREAD_ID}))
+
+	if output := c.event("output"); output["output"] != "6\n" {
+		t.Errorf("expected the program to print 6, got %v", output)
+	}
+	if exited := c.event("exited"); exited["exitCode"] != float64(0) {
+		t.Errorf("unexpected exit %v", exited)
+	}
+	c.event("terminated")
+
+	body(t, c.request("disconnect", nil))
+	if err := <-c.done; err != nil {
+		t.Errorf("Serve returned error: %s", err)
+	}
+}
+
+func TestStepping(t *testing.T) {
+	c, _ := launch(t, true)
+
+	tests := []struct {
+		command string
+		reason  string
+		stack   string
+	}{
+		{"", "entry", "[<top level>:1]"},
+		{"next", "step", "[<top level>:6]"},
+		{"next", "step", "[<top level>:7]"},
+		{"stepIn", "step", "[fact:2 <top level>:7]"},
+		{"next", "step", "[fact:3 <top level>:7]"},
+		{"stepIn", "step", "[fact:2 fact:3 <top level>:7]"},
+		{"stepOut", "step", "[fact:4 <top level>:7]"},
+	}
+
+	for _, tt := range tests {
+		if tt.command != "" {
+			body(t, c.request(tt.command, map[string]interface{}{"threadId": THREAD_ID}))
+		}
+		if reason := c.event("stopped")["reason"]; reason != tt.reason {
+			t.Errorf("%s: expected to stop for %s, stopped for %v", tt.command, tt.reason, reason)
+		}
+		if got := fmt.Sprint(stackLines(t, c)); got != tt.stack {
+			t.Errorf("%s: expected stack %s, got %s", tt.command, tt.stack, got)
+		}
+	}
+
+	body(t, c.request("terminate", nil))
+	c.event("terminated")
+	body(t, c.request("disconnect", nil))
+}
+
+func TestTerminateRunningProgram(t *testing.T) {
+	// takes far longer than the test waits for anything
+	c, _ := launchSource(t, "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };\nfib(100);\n", false)
+
+	body(t, c.request("terminate", nil))
+	c.event("terminated")
+	for _, event := range c.events {
+		if event["event"] == "exited" {
+			t.Errorf("a terminated program shouldn't exit on its own, got %v", event)
+		}
+	}
+
+	body(t, c.request("disconnect", nil))
+	if err := <-c.done; err != nil {
+		t.Errorf("Serve returned error: %s", err)
+	}
+}
+
+func TestVariables(t *testing.T) {
+	c, _ := launch(t, false, 4)
+	c.event("stopped")
+
+	scopes := body(t, c.request("scopes", ScopesArguments{FrameID: 1}))["scopes"].([]interface{})
+	if len(scopes) != 2 {
+		t.Fatalf("expected locals and globals, got %v", scopes)
+	}
+	names := map[string]int{}
+	for _, s := range scopes {
+		scope := s.(map[string]interface{})
+		names[scope["name"].(string)] = int(scope["variablesReference"].(float64))
+	}
+
+	locals := variables(t, c, names["Locals"])
+	if locals["n"]["value"] != "2" || locals["rest"]["value"] != "1" || locals["n"]["type"] != "INTEGER" {
+		t.Errorf("wrong locals %v", locals)
+	}
+
+	globals := variables(t, c, names["Globals"])
+	data := globals["data"]
+	if data["type"] != "HASH" || data["variablesReference"] == float64(0) {
+		t.Fatalf("expected data to be an expandable hash, got %v", data)
+	}
+
+	pairs := variables(t, c, int(data["variablesReference"].(float64)))
+	if pairs["name"]["value"] != "monke" {
+		t.Errorf("wrong hash contents %v", pairs)
+	}
+
+	xs := variables(t, c, int(pairs["xs"]["variablesReference"].(float64)))
+	if xs["[0]"]["value"] != "1" || xs["[1]"]["value"] != "2" {
+		t.Errorf("wrong array contents %v", xs)
+	}
+
+	body(t, c.request("disconnect", nil))
+}
+
+// fetches the variables behind ref by name
+func variables(t *testing.T, c *client, ref int) map[string]map[string]interface{} {
+	t.Helper()
+	vars := map[string]map[string]interface{}{}
+	list := body(t, c.request("variables", VariablesArguments{VariablesReference: ref}))["variables"].([]interface{})
+	for _, v := range list {
+		variable := v.(map[string]interface{})
+		vars[variable["name"].(string)] = variable
+	}
+	return vars
+}
+
+func TestLaunchErrors(t *testing.T) {
+	c := newClient(t)
+	body(t, c.request("initialize", nil))
+
+	response := c.request("launch", LaunchArguments{Program: "does-not-exist.grr"})
+	if response["success"] != false {
+		t.Errorf("launching a missing file succeeded")
+	}
+
+	response = c.request("stackTrace", StackTraceArguments{ThreadID: THREAD_ID})
+	if frames := body(t, response)["stackFrames"].([]interface{}); len(frames) != 0 {
+		t.Errorf("expected no frames before the program runs, got %v", frames)
+	}
+
+	response = c.request("next", map[string]interface{}{"threadId": THREAD_ID})
+	if response["success"] != false {
+		t.Errorf("stepping a program that isn't stopped succeeded")
+	}
+
+	body(t, c.request("disconnect", nil))
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"monke/debugger"
+	"monke/diagnostic"
+	"monke/evaluator"
+	"monke/lexer"
+	"monke/object"
+	"monke/parser"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const DEBUG_HELP = `commands:
+  break [file:]line    set a breakpoint (b)
+  clear [file:]line    remove a breakpoint
+  breakpoints          list the breakpoints
+  continue             run to the next breakpoint (c)
+  step                 run to the next statement, going into calls (s)
+  next                 run to the next statement, stepping over calls (n)
+  out                  run until the current function returns (o)
+  stack                show the call stack (bt)
+  locals               show the variables of the current scope (l)
+  print expr           evaluate expr in the current scope (p)
+  list                 show the source around the current line
+  quit                 stop the program (q)`
+
+// runs a program under the debugger, reading commands from stdin whenever it
+// stops
+func runDebug(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: monke debug file.grr")
+		return 2
+	}
+	fileName := args[0]
+
+	source, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		for _, d := range p.Diagnostics() {
+			diagnostic.Render(os.Stderr, fileName, string(source), d)
+		}
+		return 1
+	}
+
+	// the program and the debugger share stdin, so nothing the program
+	// doesn't read is lost to the debugger's buffer or the other way round
+	stdin := bufio.NewReader(os.Stdin)
+
+	in := evaluator.New()
+	in.Stdin = stdin
+	in.Dir = filepath.Dir(fileName)
+	in.File = fileName
+
+	s := &debugSession{
+		debugger: debugger.New(in, true),
+		file:     fileName,
+		in:       stdin,
+		out:      os.Stdout,
+		sources:  map[string][]string{},
+	}
+	s.debugger.OnStop = s.stopped
+
+	result, finished := s.debugger.Run(program, object.NewEnvironment())
+	if !finished {
+		return 0
+	}
+	if err, ok := result.(*object.Error); ok {
+		fmt.Fprintln(os.Stderr, err.Inspect())
+		return 1
+	}
+	fmt.Fprintln(s.out, "program finished")
+	return 0
+}
+
+// debugSession is the command line interface to a debugger
+type debugSession struct {
+	debugger *debugger.Debugger
+	file     string // the file being debugged, where breakpoints go by default
+	in       *bufio.Reader
+	out      io.Writer
+	sources  map[string][]string // the lines of the files shown so far
+	stop     debugger.Stop
+}
+
+// shows where the program stopped and handles commands until one of them
+// resumes it
+func (s *debugSession) stopped(stop debugger.Stop) {
+	s.stop = stop
+	fmt.Fprintf(s.out, "stopped at %s:%d:%d (%s)\n", displayName(stop.File), stop.Pos.Line, stop.Pos.Column, stop.Reason)
+	s.showLine(stop.File, stop.Pos.Line, true)
+
+	for {
+		fmt.Fprint(s.out, "(monke) ")
+		line, err := s.in.ReadString('\n')
+		if err != nil && line == "" {
+			// nobody left to tell us what to do
+			s.debugger.Quit()
+			return
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		cmd, arg := fields[0], strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), fields[0]))
+
+		switch cmd {
+		case "continue", "c":
+			s.debugger.Continue()
+			return
+		case "step", "s":
+			s.debugger.StepInto()
+			return
+		case "next", "n":
+			s.debugger.StepOver()
+			return
+		case "out", "o":
+			s.debugger.StepOut()
+			return
+		case "quit", "q":
+			s.debugger.Quit()
+			return
+		case "break", "b":
+			if file, line, ok := s.location(arg); ok {
+				s.debugger.SetBreakpoint(file, line)
+				fmt.Fprintf(s.out, "breakpoint at %s:%d\n", displayName(file), line)
+			}
+		case "clear":
+			if file, line, ok := s.location(arg); ok {
+				s.debugger.ClearBreakpoint(file, line)
+			}
+		case "breakpoints":
+			for _, line := range s.debugger.Breakpoints(s.file) {
+				fmt.Fprintf(s.out, "%s:%d\n", displayName(s.file), line)
+			}
+		case "stack", "bt":
+			for i, frame := range s.debugger.Stack() {
+				fmt.Fprintf(s.out, "#%d %s at %s:%d:%d\n", i, frame.Name,
+					displayName(frame.File), frame.Pos.Line, frame.Pos.Column)
+			}
+		case "locals", "l":
+			for _, v := range debugger.Variables(stop.Env) {
+				fmt.Fprintf(s.out, "%s = %s\n", v.Name, v.Value.Inspect())
+			}
+		case "print", "p":
+			s.print(arg)
+		case "list":
+			for line := stop.Pos.Line - 3; line <= stop.Pos.Line+3; line++ {
+				s.showLine(stop.File, line, line == stop.Pos.Line)
+			}
+		case "help", "h":
+			fmt.Fprintln(s.out, DEBUG_HELP)
+		default:
+			fmt.Fprintf(s.out, "unknown command %q, try help\n", cmd)
+		}
+	}
+}
+
+// parses a breakpoint location, either a line in the file being debugged or
+// file:line
+func (s *debugSession) location(arg string) (string, int, bool) {
+	file, lineText := s.file, arg
+	if i := strings.LastIndex(arg, ":"); i >= 0 {
+		file, lineText = arg[:i], arg[i+1:]
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(s.file), file)
+		}
+	}
+
+	line, err := strconv.Atoi(lineText)
+	if err != nil || line < 1 {
+		fmt.Fprintf(s.out, "expected a line number or file:line, got %q\n", arg)
+		return "", 0, false
+	}
+	return file, line, true
+}
+
+// evaluates the expression in arg where the program stopped
+func (s *debugSession) print(arg string) {
+	p := parser.New(lexer.New(arg))
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		fmt.Fprintln(s.out, p.Diagnostics()[0].Message)
+		return
+	}
+
+	result := s.debugger.Evaluate(program, s.stop.Env)
+	if result == nil {
+		result = evaluator.NULL
+	}
+	fmt.Fprintln(s.out, result.Inspect())
+}
+
+// prints a line of file with its number, marking the current one
+func (s *debugSession) showLine(file string, line int, current bool) {
+	lines, ok := s.sources[file]
+	if !ok {
+		source, err := ioutil.ReadFile(file)
+		if err == nil {
+			lines = strings.Split(string(source), "\n")
+		}
+		s.sources[file] = lines
+	}
+	if line < 1 || line > len(lines) {
+		return
+	}
+
+	marker := " "
+	if current {
+		marker = ">"
+	}
+	fmt.Fprintf(s.out, "%s %4d  %s\n", marker, line, lines[line-1])
+}
+
+func displayName(file string) string {
+	if file == "" {
+		return "<input>"
+	}
+	return file
+}
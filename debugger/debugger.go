@@ -0,0 +1,362 @@
+// Package debugger pauses a running Monke program at breakpoints and between
+// steps, and lets the host look at its call stack and variables while it is
+// paused. It is driven through the interpreter's Hook, so the program runs
+// at full speed apart from a check before every statement.
+package debugger
+
+import (
+	"errors"
+	"monke/ast"
+	"monke/evaluator"
+	"monke/object"
+	"monke/token"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// how the program runs until it next stops
+const (
+	CONTINUE  = iota // until a breakpoint
+	STEP_INTO        // to the next statement
+	STEP_OVER        // to the next statement that isn't inside a call
+	STEP_OUT         // to the next statement after the current call returns
+)
+
+// reasons for stopping
+const (
+	ENTRY      = "entry"
+	BREAKPOINT = "breakpoint"
+	STEP       = "step"
+)
+
+// Stop is a place where the program paused.
+type Stop struct {
+	Reason    string
+	Statement ast.Statement // the statement about to run
+	File      string
+	Pos       token.Position
+	Env       *object.Environment
+}
+
+// StackFrame is a function call, or the top level of a file, on the call
+// stack.
+type StackFrame struct {
+	Name string // the function's name, or "<top level>"
+	File string
+	Pos  token.Position // where the frame is at right now
+	Env  *object.Environment
+}
+
+// Variable is a name bound in an environment.
+type Variable struct {
+	Name  string
+	Value object.Object
+}
+
+// Debugger runs programs on an interpreter and pauses them as its mode and
+// breakpoints say. OnStop is called every time the program pauses, and the
+// program resumes when it returns, running as the last of Continue, StepInto,
+// StepOver and StepOut called says.
+//
+// Breakpoints can be changed and Quit called from other goroutines while the
+// program runs. Everything else must only be called from OnStop, or while the program is
+// stopped in it.
+type Debugger struct {
+	OnStop func(stop Stop)
+
+	interp *evaluator.Interpreter
+	mu     sync.Mutex // guards breakpoints and quitting
+	// lines with breakpoints by canonical file name
+	breakpoints map[string]map[int]bool
+	mode        int
+	depth       int // how deep the call stack was when the step began
+	stopOnEntry bool
+	quitting    bool
+
+	// where the program last stopped, so continuing from a breakpoint doesn't
+	// stop at the next statement on the same line right away
+	stopped   bool
+	last      Stop
+	lastDepth int
+
+	// canonical names of the files seen so far
+	files map[string]string
+}
+
+// errQuit unwinds the interpreter when the program is quit
+var errQuit = errors.New("quit")
+
+// creates a new Debugger that debugs the programs in evaluates. It stops
+// before the first statement if stopOnEntry is set.
+func New(in *evaluator.Interpreter, stopOnEntry bool) *Debugger {
+	d := &Debugger{
+		interp:      in,
+		breakpoints: make(map[string]map[int]bool),
+		stopOnEntry: stopOnEntry,
+		files:       make(map[string]string),
+	}
+	in.Hook = d.hook
+	return d
+}
+
+// Run evaluates program in env under the debugger and returns its result.
+// It reports whether the program ran to the end rather than being quit.
+func (d *Debugger) Run(program *ast.Program, env *object.Environment) (result object.Object, finished bool) {
+	d.mode = CONTINUE
+	if d.stopOnEntry {
+		d.mode = STEP_INTO
+	}
+	d.stopped = false
+
+	defer func() {
+		// a Quit from before the program started stops it right away, so
+		// only forget it once the program is over
+		d.mu.Lock()
+		d.quitting = false
+		d.mu.Unlock()
+
+		if r := recover(); r != nil {
+			if r != errQuit {
+				panic(r)
+			}
+			result, finished = nil, false
+		}
+	}()
+
+	return d.interp.Eval(program, env), true
+}
+
+// SetBreakpoints replaces the breakpoints in file with the given lines.
+func (d *Debugger) SetBreakpoints(file string, lines []int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	file = canonical(file)
+	d.breakpoints[file] = make(map[int]bool)
+	for _, line := range lines {
+		d.breakpoints[file][line] = true
+	}
+}
+
+// SetBreakpoint adds a breakpoint on line of file.
+func (d *Debugger) SetBreakpoint(file string, line int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	file = canonical(file)
+	if d.breakpoints[file] == nil {
+		d.breakpoints[file] = make(map[int]bool)
+	}
+	d.breakpoints[file][line] = true
+}
+
+// ClearBreakpoint removes the breakpoint on line of file, if there is one.
+func (d *Debugger) ClearBreakpoint(file string, line int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.breakpoints[canonical(file)], line)
+}
+
+// Breakpoints returns the lines with breakpoints in file in order.
+func (d *Debugger) Breakpoints(file string) []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	lines := []int{}
+	for line := range d.breakpoints[canonical(file)] {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// Continue runs the program until it hits a breakpoint.
+func (d *Debugger) Continue() { d.resume(CONTINUE) }
+
+// StepInto runs the program to the next statement, going into calls.
+func (d *Debugger) StepInto() { d.resume(STEP_INTO) }
+
+// StepOver runs the program to the next statement, running calls to the end.
+func (d *Debugger) StepOver() { d.resume(STEP_OVER) }
+
+// StepOut runs the program until the current call returns.
+func (d *Debugger) StepOut() { d.resume(STEP_OUT) }
+
+// Quit stops the program for good at the next statement it runs, or once
+// OnStop returns if it is stopped.
+func (d *Debugger) Quit() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.quitting = true
+}
+
+// reports whether Quit was called since the program started
+func (d *Debugger) hasQuit() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.quitting
+}
+
+func (d *Debugger) resume(mode int) {
+	d.mode = mode
+	d.depth = d.interp.Depth()
+}
+
+// Stack returns the call stack with the innermost frame first. It is only
+// meaningful while the program is stopped.
+func (d *Debugger) Stack() []StackFrame {
+	frames := d.interp.Stack()
+	stack := []StackFrame{{
+		Name: frameName(frames, len(frames)-1),
+		File: d.last.File,
+		Pos:  d.last.Pos,
+		Env:  d.last.Env,
+	}}
+
+	for i := len(frames) - 1; i >= 0; i-- {
+		frame := StackFrame{
+			Name: frameName(frames, i-1),
+			File: frames[i].CallFile,
+			Env:  frames[i].CallEnv,
+		}
+		// functions called by the host have no call in the program
+		if frames[i].Call != nil {
+			frame.Pos = frames[i].Call.Token.Pos
+		}
+		stack = append(stack, frame)
+	}
+
+	return stack
+}
+
+// returns the name of the function of frames[i], with -1 being the top level
+func frameName(frames []evaluator.Frame, i int) string {
+	if i < 0 {
+		return "<top level>"
+	}
+	if name := frames[i].Function.Name; name != "" {
+		return name
+	}
+	return "<anonymous>"
+}
+
+// Variables returns the names bound directly in env and their values in
+// order of name.
+func Variables(env *object.Environment) []Variable {
+	vars := []Variable{}
+	for _, name := range env.Names() {
+		value, _ := env.Get(name)
+		vars = append(vars, Variable{Name: name, Value: value})
+	}
+	return vars
+}
+
+// Evaluate evaluates expr in env without stopping in it, for looking at
+// values while the program is paused.
+func (d *Debugger) Evaluate(expr ast.Node, env *object.Environment) object.Object {
+	hook := d.interp.Hook
+	d.interp.Hook = nil
+	defer func() { d.interp.Hook = hook }()
+
+	return d.interp.Eval(expr, env)
+}
+
+func (d *Debugger) hook(node ast.Node, env *object.Environment) {
+	if d.hasQuit() {
+		panic(errQuit)
+	}
+
+	stmt, ok := node.(ast.Statement)
+	if !ok {
+		return
+	}
+	pos, ok := statementPos(stmt)
+	if !ok {
+		return
+	}
+
+	depth := d.interp.Depth()
+	file := d.interp.File
+
+	reason := ""
+	switch {
+	case d.mode == STEP_INTO,
+		d.mode == STEP_OVER && depth <= d.depth,
+		d.mode == STEP_OUT && depth < d.depth:
+		reason = STEP
+		if !d.stopped && d.stopOnEntry {
+			reason = ENTRY
+		}
+	case d.hasBreakpoint(file, pos.Line) && !d.sameLine(file, pos, depth):
+		reason = BREAKPOINT
+	default:
+		return
+	}
+
+	d.stopped = true
+	d.last = Stop{Reason: reason, Statement: stmt, File: file, Pos: pos, Env: env}
+	d.lastDepth = depth
+	d.mode = CONTINUE
+
+	if d.OnStop != nil {
+		d.OnStop(d.last)
+	}
+	if d.hasQuit() {
+		panic(errQuit)
+	}
+}
+
+func (d *Debugger) hasBreakpoint(file string, line int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.breakpoints[d.canonical(file)][line]
+}
+
+// reports whether the program is still on the line it last stopped at
+func (d *Debugger) sameLine(file string, pos token.Position, depth int) bool {
+	return d.stopped && file == d.last.File && pos.Line == d.last.Pos.Line && depth == d.lastDepth
+}
+
+// returns where stmt starts. Blocks aren't statements one can stop at, the
+// statements in them are.
+func statementPos(stmt ast.Statement) (token.Position, bool) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token.Pos, true
+	case *ast.ReturnStatement:
+		return stmt.Token.Pos, true
+	case *ast.ThrowStatement:
+		return stmt.Token.Pos, true
+	case *ast.FunctionDeclaration:
+		return stmt.Token.Pos, true
+	case *ast.ExpressionStatement:
+		return stmt.Token.Pos, true
+	}
+	return token.Position{}, false
+}
+
+// like canonical, but remembers the result since it runs for every statement
+func (d *Debugger) canonical(file string) string {
+	name, ok := d.files[file]
+	if !ok {
+		name = canonical(file)
+		d.files[file] = name
+	}
+	return name
+}
+
+// file names are compared as absolute, cleaned paths
+func canonical(file string) string {
+	if file == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(file); err == nil {
+		return abs
+	}
+	return filepath.Clean(file)
+}
@@ -0,0 +1,180 @@
+package debugger
+
+import (
+	"fmt"
+	"monke/evaluator"
+	"monke/lexer"
+	"monke/object"
+	"monke/parser"
+	"strings"
+	"testing"
+	"time"
+)
+
+const PROGRAM = `fn fact(n) {
+  if (n < 2) { return 1 };
+  let rest = fact(n - 1);
+  n * rest
+}
+let x = fact(3);
+x`
+
+// runs PROGRAM, calling act at every stop with the stop and how many stops
+// came before it. It returns where the stops were as "line:reason".
+func run(t *testing.T, breakpoints []int, stopOnEntry bool, act func(d *Debugger, stop Stop, i int)) ([]string, object.Object, bool) {
+	t.Helper()
+
+	p := parser.New(lexer.New(PROGRAM))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	in := evaluator.New()
+	in.File = "fact.grr"
+	d := New(in, stopOnEntry)
+	d.SetBreakpoints("fact.grr", breakpoints)
+
+	var stops []string
+	d.OnStop = func(stop Stop) {
+		stops = append(stops, fmt.Sprintf("%d:%s", stop.Pos.Line, stop.Reason))
+		if len(stops) > 50 {
+			t.Fatalf("too many stops: %v", stops)
+		}
+		act(d, stop, len(stops)-1)
+	}
+
+	result, finished := d.Run(program, object.NewEnvironment())
+	return stops, result, finished
+}
+
+func TestStepping(t *testing.T) {
+	tests := []struct {
+		name        string
+		breakpoints []int
+		stopOnEntry bool
+		act         func(d *Debugger)
+		expected    []string
+	}{
+		{"breakpoints", []int{3}, false, (*Debugger).Continue,
+			[]string{"3:breakpoint", "3:breakpoint"}},
+		{"no breakpoints", nil, false, (*Debugger).Continue, nil},
+		{"step into", nil, true, (*Debugger).StepInto, []string{
+			"1:entry", "6:step", "2:step", "3:step", "2:step", "3:step", "2:step", "2:step",
+			"4:step", "4:step", "7:step",
+		}},
+		{"step over", nil, true, (*Debugger).StepOver, []string{"1:entry", "6:step", "7:step"}},
+		{"step out", []int{3}, false, (*Debugger).StepOut,
+			// the breakpoint is hit again in the recursive call before the
+			// first one returns
+			[]string{"3:breakpoint", "3:breakpoint", "4:step", "7:step"}},
+	}
+
+	for _, tt := range tests {
+		stops, result, finished := run(t, tt.breakpoints, tt.stopOnEntry, func(d *Debugger, stop Stop, i int) {
+			tt.act(d)
+		})
+
+		if strings.Join(stops, " ") != strings.Join(tt.expected, " ") {
+			t.Errorf("%s: wrong stops.\nexpected=%v\ngot=%v", tt.name, tt.expected, stops)
+		}
+		if !finished || result.Inspect() != "6" {
+			t.Errorf("%s: program didn't finish with 6. got=%v finished=%t", tt.name, result, finished)
+		}
+	}
+}
+
+func TestStack(t *testing.T) {
+	var stack []StackFrame
+	run(t, []int{4}, false, func(d *Debugger, stop Stop, i int) {
+		if i == 0 {
+			stack = d.Stack()
+		}
+	})
+
+	// fact(1) returns early, so the first stop is in fact(2)
+	expected := []string{"fact 4", "fact 3", "<top level> 6"}
+	if len(stack) != len(expected) {
+		t.Fatalf("expected %d frames, got %d: %v", len(expected), len(stack), stack)
+	}
+	for i, frame := range stack {
+		if got := fmt.Sprintf("%s %d", frame.Name, frame.Pos.Line); got != expected[i] {
+			t.Errorf("frame %d is %q, expected %q", i, got, expected[i])
+		}
+	}
+
+	if vars := Variables(stack[0].Env); len(vars) != 2 || vars[0].Name != "n" || vars[1].Name != "rest" ||
+		vars[0].Value.Inspect() != "2" {
+		t.Errorf("wrong variables in the innermost frame: %v", vars)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	var value string
+	run(t, []int{4}, false, func(d *Debugger, stop Stop, i int) {
+		if i == 0 {
+			p := parser.New(lexer.New("n * 10 + fact(3)"))
+			value = d.Evaluate(p.ParseProgram(), stop.Env).Inspect()
+		}
+	})
+
+	if value != "26" {
+		t.Errorf("expected 26, got %q", value)
+	}
+}
+
+func TestQuit(t *testing.T) {
+	stops, result, finished := run(t, []int{3}, false, func(d *Debugger, stop Stop, i int) {
+		d.Quit()
+	})
+
+	if finished || result != nil || len(stops) != 1 {
+		t.Errorf("program wasn't quit at the first stop. stops=%v result=%v", stops, result)
+	}
+}
+
+// a program that never stops can be quit from another goroutine
+func TestQuitWhileRunning(t *testing.T) {
+	p := parser.New(lexer.New("let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(100)"))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	d := New(evaluator.New(), false)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		d.Quit()
+	}()
+
+	quit := make(chan bool)
+	go func() {
+		_, finished := d.Run(program, object.NewEnvironment())
+		quit <- !finished
+	}()
+
+	select {
+	case ok := <-quit:
+		if !ok {
+			t.Errorf("program finished instead of being quit")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("program is still running")
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	d := New(evaluator.New(), false)
+	d.SetBreakpoint("a.grr", 3)
+	d.SetBreakpoint("a.grr", 1)
+	d.SetBreakpoint("b.grr", 2)
+	d.ClearBreakpoint("a.grr", 3)
+
+	if got := fmt.Sprint(d.Breakpoints("a.grr")); got != "[1]" {
+		t.Errorf("wrong breakpoints in a.grr: %s", got)
+	}
+	d.SetBreakpoints("b.grr", []int{5, 4})
+	if got := fmt.Sprint(d.Breakpoints("./b.grr")); got != "[4 5]" {
+		t.Errorf("wrong breakpoints in b.grr: %s", got)
+	}
+}
@@ -0,0 +1,134 @@
+package diagnostic
+
+import (
+	"fmt"
+	"io"
+	"monke/token"
+	"strings"
+)
+
+type Severity int
+
+const (
+	ERROR Severity = iota
+	WARNING
+	INFO
+)
+
+func (s Severity) String() string {
+	switch s {
+	case ERROR:
+		return "error"
+	case WARNING:
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+// Span is the part of the source a diagnostic is about. End is exclusive.
+type Span struct {
+	Start token.Position
+	End   token.Position
+}
+
+// SpanOf returns the span covered by tok.
+func SpanOf(tok token.Token) Span {
+	width := len(tok.Literal)
+	if tok.Type == token.STRING {
+		width += 2 // the quotes aren't part of the literal
+	}
+
+	end := tok.Pos
+	end.Offset += width
+	end.Column += width
+
+	return Span{Start: tok.Pos, End: end}
+}
+
+// Diagnostic is a problem found in a program, along with where it is and
+// possibly how to fix it. Code identifies the kind of problem so tools don't
+// have to match on Message.
+type Diagnostic struct {
+	Severity    Severity
+	Code        string
+	Message     string
+	Span        Span
+	Suggestions []string
+}
+
+// String returns the diagnostic on a single line, e.g.
+// "1:5: error[P001]: expected next token to be =, got INT instead"
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s[%s]: %s", d.Span.Start.Line, d.Span.Start.Column,
+		d.Severity, d.Code, d.Message)
+}
+
+// Render writes d the way a compiler would, with the offending line of source
+// and a caret underline below it:
+//
+//	error[P001]: expected next token to be ), got { instead
+//	 --> main.grr:1:17
+//	  |
+//	1 | let f = fn(a, b { a + b };
+//	  |                 ^
+//	  = help: did you mean `)`?
+func Render(w io.Writer, filename, source string, d Diagnostic) {
+	start := d.Span.Start
+	lineNumber := fmt.Sprintf("%d", start.Line)
+	gutter := strings.Repeat(" ", len(lineNumber))
+
+	location := fmt.Sprintf("%d:%d", start.Line, start.Column)
+	if filename != "" {
+		location = filename + ":" + location
+	}
+
+	fmt.Fprintf(w, "%s[%s]: %s\n", d.Severity, d.Code, d.Message)
+	fmt.Fprintf(w, "%s --> %s\n", gutter, location)
+
+	if line, ok := sourceLine(source, start.Line); ok {
+		width := d.Span.End.Column - start.Column
+		if d.Span.End.Line != start.Line || width < 1 {
+			width = 1
+		}
+		if max := len(line) - start.Column + 1; width > max && max > 0 {
+			width = max
+		}
+
+		// keep tabs so the caret lines up however wide they are shown
+		before := ""
+		if start.Column > 1 {
+			before = line[:min(start.Column-1, len(line))]
+		}
+		padding := strings.Map(func(r rune) rune {
+			if r == '\t' {
+				return '\t'
+			}
+			return ' '
+		}, before)
+
+		fmt.Fprintf(w, "%s |\n", gutter)
+		fmt.Fprintf(w, "%s | %s\n", lineNumber, line)
+		fmt.Fprintf(w, "%s | %s%s\n", gutter, padding, strings.Repeat("^", width))
+	}
+
+	for _, suggestion := range d.Suggestions {
+		fmt.Fprintf(w, "%s = help: %s\n", gutter, suggestion)
+	}
+}
+
+// returns the line-th line of source, counting from 1
+func sourceLine(source string, line int) (string, bool) {
+	lines := strings.Split(source, "\n")
+	if line < 1 || line > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[line-1], "\r"), true
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
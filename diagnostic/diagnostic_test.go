@@ -0,0 +1,91 @@
+package diagnostic
+
+import (
+	"bytes"
+	"monke/token"
+	"testing"
+)
+
+func TestSpanOf(t *testing.T) {
+	tests := []struct {
+		tok      token.Token
+		expected int
+	}{
+		{token.Token{Type: token.IDENT, Literal: "foo", Pos: token.Position{Offset: 4, Line: 1, Column: 5}}, 8},
+		{token.Token{Type: token.STRING, Literal: "hi", Pos: token.Position{Offset: 4, Line: 1, Column: 5}}, 9},
+		{token.Token{Type: token.EOF, Literal: "", Pos: token.Position{Offset: 4, Line: 1, Column: 5}}, 5},
+	}
+
+	for _, tt := range tests {
+		span := SpanOf(tt.tok)
+		if span.Start != tt.tok.Pos {
+			t.Errorf("span.Start wrong. expected=%+v, got=%+v", tt.tok.Pos, span.Start)
+		}
+		if span.End.Column != tt.expected {
+			t.Errorf("span.End.Column wrong for %q. expected=%d, got=%d",
+				tt.tok.Literal, tt.expected, span.End.Column)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	d := Diagnostic{
+		Severity: WARNING,
+		Code:     "L001",
+		Message:  "unused variable x",
+		Span:     Span{Start: token.Position{Line: 3, Column: 5}},
+	}
+
+	expected := "3:5: warning[L001]: unused variable x"
+	if d.String() != expected {
+		t.Errorf("d.String() wrong. expected=%q, got=%q", expected, d.String())
+	}
+}
+
+func TestRender(t *testing.T) {
+	source := "let x = 1;\n\tlet f = fn(a, b { a + b };\n"
+	d := Diagnostic{
+		Severity: ERROR,
+		Code:     "P001",
+		Message:  "expected next token to be ), got { instead",
+		Span: Span{
+			Start: token.Position{Offset: 28, Line: 2, Column: 18},
+			End:   token.Position{Offset: 29, Line: 2, Column: 19},
+		},
+		Suggestions: []string{"did you mean `)`?"},
+	}
+
+	var out bytes.Buffer
+	Render(&out, "main.grr", source, d)
+
+	expected := "error[P001]: expected next token to be ), got { instead\n" +
+		"  --> main.grr:2:18\n" +
+		"  |\n" +
+		"2 | \tlet f = fn(a, b { a + b };\n" +
+		"  | \t                ^\n" +
+		"  = help: did you mean `)`?\n"
+
+	if out.String() != expected {
+		t.Errorf("Render wrong.\nexpected=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestRenderUnderlinesSpan(t *testing.T) {
+	d := Diagnostic{
+		Severity: ERROR,
+		Code:     "P003",
+		Message:  "could not parse",
+		Span: Span{
+			Start: token.Position{Line: 1, Column: 9},
+			End:   token.Position{Line: 1, Column: 14},
+		},
+	}
+
+	var out bytes.Buffer
+	Render(&out, "", "let x = 99999;", d)
+
+	expected := "  | " + "        ^^^^^\n"
+	if !bytes.HasSuffix(out.Bytes(), []byte(expected)) {
+		t.Errorf("Render wrong. got=\n%s", out.String())
+	}
+}
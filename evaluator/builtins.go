@@ -2,115 +2,111 @@ package evaluator
 
 import (
 	"fmt"
+	"io"
 	"monke/object"
+	"strings"
 )
 
-var builtins = map[string]*object.Builtin{
-	"len": {Fn: func(args ...object.Object) object.Object {
-		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1",
-				len(args))
-		}
-
-		switch arg := args[0].(type) {
-		case *object.Array:
-			return &object.Integer{Value: int64(len(arg.Elements))}
-		case *object.String:
-			return &object.Integer{Value: int64(len(arg.Value))}
-		default:
-			return newError("argument to `len` not supported, got %s",
-				args[0].Type())
-		}
-	},
-	},
-	"puts": {
-		Fn: func(args ...object.Object) object.Object {
-			for _, arg := range args {
-				fmt.Println(arg.Inspect())
-			}
-			return NULL
-		},
-	},
-	"first": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
-					len(args))
-			}
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `first` must be ARRAY, got %s",
-					args[0].Type())
-			}
-
-			arr := args[0].(*object.Array)
-			if len(arr.Elements) > 0 {
-				return arr.Elements[0]
-			}
-
-			return NULL
-		},
-	},
-	"last": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
-					len(args))
-			}
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `last` must be ARRAY, got %s",
-					args[0].Type())
-			}
-
-			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
-			if length > 0 {
-				return arr.Elements[length-1]
-			}
-
-			return NULL
-		},
-	},
-	"rest": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
-					len(args))
-			}
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `rest` must be ARRAY, got %s",
-					args[0].Type())
-			}
-
-			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
-			if length > 0 {
-				newElements := make([]object.Object, length-1, length-1)
-				copy(newElements, arr.Elements[1:length])
-				return &object.Array{Elements: newElements}
-			}
-
-			return NULL
-		},
-	},
-	"push": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2",
-					len(args))
-			}
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `push` must be ARRAY, got %s",
-					args[0].Type())
-			}
-
-			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
-
-			newElements := make([]object.Object, length+1, length+1)
-			copy(newElements, arr.Elements)
-			newElements[length] = args[1]
-
-			return &object.Array{Elements: newElements}
-		},
-	},
+// registers the builtins every new Interpreter starts out with
+func (in *Interpreter) registerDefaultBuiltins() {
+	in.Register("len", 1, builtinLen)
+	in.Register("puts", VARIADIC, in.builtinPuts)
+	in.Register("gets", 0, in.builtinGets)
+	in.Register("first", 1, builtinFirst)
+	in.Register("last", 1, builtinLast)
+	in.Register("rest", 1, builtinRest)
+	in.Register("push", 2, builtinPush)
+}
+
+func builtinLen(args ...object.Object) object.Object {
+	switch arg := args[0].(type) {
+	case *object.Array:
+		return newInteger(int64(len(arg.Elements)))
+	case *object.String:
+		return newInteger(int64(len(arg.Value)))
+	default:
+		return newError(object.TYPE_ERROR, "argument to `len` not supported, got %s",
+			args[0].Type())
+	}
+}
+
+func (in *Interpreter) builtinPuts(args ...object.Object) object.Object {
+	for _, arg := range args {
+		fmt.Fprintln(in.Stdout, arg.Inspect())
+	}
+	return NULL
+}
+
+// reads one line from Stdin without its line ending. Returns null once the
+// input is exhausted.
+func (in *Interpreter) builtinGets(args ...object.Object) object.Object {
+	line, err := in.stdinReader().ReadString('\n')
+	if err == io.EOF && line == "" {
+		return NULL
+	}
+	if err != nil && err != io.EOF {
+		return newError(object.IO_ERROR, "could not read from stdin: %s", err)
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return &object.String{Value: line}
+}
+
+func builtinFirst(args ...object.Object) object.Object {
+	arr, err := ArrayArg("first", args, 0)
+	if err != nil {
+		return err
+	}
+
+	if len(arr.Elements) > 0 {
+		return arr.Elements[0]
+	}
+
+	return NULL
+}
+
+func builtinLast(args ...object.Object) object.Object {
+	arr, err := ArrayArg("last", args, 0)
+	if err != nil {
+		return err
+	}
+
+	length := len(arr.Elements)
+	if length > 0 {
+		return arr.Elements[length-1]
+	}
+
+	return NULL
+}
+
+func builtinRest(args ...object.Object) object.Object {
+	arr, err := ArrayArg("rest", args, 0)
+	if err != nil {
+		return err
+	}
+
+	length := len(arr.Elements)
+	if length > 0 {
+		newElements := make([]object.Object, length-1, length-1)
+		copy(newElements, arr.Elements[1:length])
+		return &object.Array{Elements: newElements}
+	}
+
+	return NULL
+}
+
+func builtinPush(args ...object.Object) object.Object {
+	arr, err := ArrayArg("push", args, 0)
+	if err != nil {
+		return err
+	}
+
+	length := len(arr.Elements)
+
+	newElements := make([]object.Object, length+1, length+1)
+	copy(newElements, arr.Elements)
+	newElements[length] = args[1]
+
+	return &object.Array{Elements: newElements}
 }
@@ -0,0 +1,67 @@
+package evaluator
+
+import (
+	"monke/ast"
+)
+
+// Coverage counts how often the statements of each file ran, recorded
+// between StartCoverage and StopCoverage. Files are named as in.File was
+// while they ran.
+type Coverage struct {
+	Files map[string]*FileCoverage
+}
+
+// FileCoverage counts what ran in one file by the offset in the source where
+// it starts. Which branch of an if ran follows from how often its blocks ran.
+type FileCoverage struct {
+	Statements map[int]int // by the offset of the first token
+	Blocks     map[int]int // by the offset of the '{'
+	Ifs        map[int]int // by the offset of the 'if'
+}
+
+// StartCoverage starts counting the statements, blocks and ifs in evaluates.
+// Counts recorded before are thrown away.
+func (in *Interpreter) StartCoverage() {
+	in.coverage = &Coverage{Files: make(map[string]*FileCoverage)}
+}
+
+// StopCoverage stops counting and returns the counts, or nil if nothing was
+// being counted.
+func (in *Interpreter) StopCoverage() *Coverage {
+	c := in.coverage
+	in.coverage = nil
+	return c
+}
+
+// File returns the counts of file, which are empty if nothing in it ran.
+func (c *Coverage) File(file string) *FileCoverage {
+	fc, ok := c.Files[file]
+	if !ok {
+		fc = &FileCoverage{
+			Statements: make(map[int]int),
+			Blocks:     make(map[int]int),
+			Ifs:        make(map[int]int),
+		}
+		c.Files[file] = fc
+	}
+	return fc
+}
+
+func (c *Coverage) record(file string, node ast.Node) {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		c.File(file).Statements[node.Token.Pos.Offset]++
+	case *ast.ReturnStatement:
+		c.File(file).Statements[node.Token.Pos.Offset]++
+	case *ast.ThrowStatement:
+		c.File(file).Statements[node.Token.Pos.Offset]++
+	case *ast.FunctionDeclaration:
+		c.File(file).Statements[node.Token.Pos.Offset]++
+	case *ast.ExpressionStatement:
+		c.File(file).Statements[node.Token.Pos.Offset]++
+	case *ast.BlockStatement:
+		c.File(file).Blocks[node.Token.Pos.Offset]++
+	case *ast.IfExpression:
+		c.File(file).Ifs[node.Token.Pos.Offset]++
+	}
+}
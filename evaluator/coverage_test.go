@@ -0,0 +1,56 @@
+package evaluator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+	input := `fn sign(n) { if (n < 0) { return -1 }; 1 }
+let unused = fn() { 0 };
+sign(2); sign(3);
+if (true) { 1 } else { 2 }`
+
+	in := New()
+	in.File = "main.grr"
+	in.StartCoverage()
+	testEvalWith(in, input)
+	c := in.StopCoverage()
+
+	if in.StopCoverage() != nil {
+		t.Errorf("StopCoverage returned counts twice")
+	}
+	fc, ok := c.Files["main.grr"]
+	if !ok {
+		t.Fatalf("nothing recorded for main.grr: %v", c.Files)
+	}
+
+	// offsets of the source text that follows the position
+	at := func(s string) int { return strings.Index(input, s) }
+
+	tests := []struct {
+		counts map[int]int
+		offset int
+		count  int
+	}{
+		{fc.Statements, at("fn sign"), 1},
+		{fc.Statements, at("if (n"), 2},
+		{fc.Statements, at("return -1"), 0},
+		{fc.Statements, at("1 }\nlet"), 2},
+		{fc.Statements, at("let unused"), 1},
+		{fc.Statements, at("0 }"), 0},
+		{fc.Statements, at("sign(3)"), 1},
+		{fc.Ifs, at("if (n"), 2},
+		{fc.Ifs, at("if (true)"), 1},
+		{fc.Blocks, at("{ if"), 2},
+		{fc.Blocks, at("{ return"), 0},
+		{fc.Blocks, at("{ 1 }"), 1},
+		{fc.Blocks, at("{ 2 }"), 0},
+	}
+
+	for i, tt := range tests {
+		if got := tt.counts[tt.offset]; got != tt.count {
+			t.Errorf("tests[%d] - wrong count at offset %d. want=%d, got=%d", i, tt.offset, tt.count, got)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"monke/ast"
 	"monke/object"
+	"monke/resolver"
 )
 
 var (
@@ -12,36 +13,110 @@ var (
 	FALSE = &object.Boolean{Value: false}
 )
 
+// Integers from SMALL_INT_MIN to SMALL_INT_MAX are created once and shared,
+// since most of the integers programs compute with are small. Integers are
+// never changed once created, so sharing them is safe.
+const (
+	SMALL_INT_MIN = -128
+	SMALL_INT_MAX = 1023
+)
+
+var smallInts [SMALL_INT_MAX - SMALL_INT_MIN + 1]object.Integer
+
+func init() {
+	for i := range smallInts {
+		smallInts[i].Value = int64(i + SMALL_INT_MIN)
+	}
+}
+
+// returns the integer value, shared if it is small
+func newInteger(value int64) *object.Integer {
+	if value >= SMALL_INT_MIN && value <= SMALL_INT_MAX {
+		return &smallInts[value-SMALL_INT_MIN]
+	}
+	return &object.Integer{Value: value}
+}
+
+// Eval evaluates node in env using a new interpreter with the default
+// builtins, so calls share no state and can run at the same time.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return New().Eval(node, env)
+}
+
+// Eval evaluates node in env and returns the resulting object. Builtins are
+// resolved against the ones registered on in.
+func (in *Interpreter) Eval(node ast.Node, env *object.Environment) object.Object {
+	if in.MaxSteps > 0 {
+		if !in.running {
+			in.running, in.Steps = true, 0
+			defer func() { in.running = false }()
+		}
+		in.Steps++
+		if in.Steps > in.MaxSteps {
+			return newError(object.STEP_LIMIT_ERROR, "step budget of %d exceeded", in.MaxSteps)
+		}
+	}
+	if in.Hook != nil {
+		in.Hook(node, env)
+	}
+	if in.coverage != nil {
+		in.coverage.record(in.File, node)
+	}
+
+	result := in.eval(node, env)
+	if in.profile != nil {
+		in.profile.allocated(node, result)
+	}
+	return result
+}
+
+func (in *Interpreter) eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 
 	// Statements
 	case *ast.Program:
-		return evalProgram(node, env)
+		return in.evalProgram(node, env)
 
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return in.evalBlockStatement(node, env)
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return in.Eval(node.Expression, env)
 
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		val := in.Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
+	case *ast.ThrowStatement:
+		val := in.Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return newThrownError(val)
+
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		val := in.Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		// a function literal bound with let is named after its binding
+		if fn, ok := val.(*object.Function); ok && fn.Name == "" {
+			if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+				fn.Name = node.Name.Value
+			}
+		}
+		bind(env, node.Name, val)
+
+	case *ast.FunctionDeclaration:
+		// already bound by hoistFunctions
+		return nil
 
 	// Expressions
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return newInteger(node.Value)
 
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
@@ -50,19 +125,19 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return nativeBoolToBooleanObject(node.Value)
 
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := in.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		left := in.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
 
-		right := Eval(node.Right, env)
+		right := in.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
@@ -70,60 +145,74 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalInfixExpression(node.Operator, left, right)
 
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return in.evalIfExpression(node, env)
 
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return in.evalIdentifier(node, env)
 
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		fn := &object.Function{Parameters: params, Defaults: node.Defaults, Rest: node.Rest, Env: env, Body: body, File: in.File, Locals: node.Locals}
+		if node.Name != nil {
+			fn.Name = node.Name.Value
+		}
+		return fn
 
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
+		function := in.Eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
 
-		args := evalExpressions(node.Arguments, env)
+		args := in.evalExpressions(node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		return in.applyFunction(node, env, function, args)
 
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
+		elements := in.evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
 
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := in.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
+		index := in.Eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
 		return evalIndexExpression(left, index)
 
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return in.evalHashLiteral(node, env)
+
+	case *ast.ImportExpression:
+		return in.evalImportExpression(node)
+
+	case *ast.TryExpression:
+		return in.evalTryExpression(node, env)
 
 	}
 
 	return nil
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func (in *Interpreter) evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
+	if !program.Slotted {
+		resolver.AssignSlots(program)
+	}
+	in.hoistFunctions(program.Statements, env)
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = in.Eval(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
@@ -136,14 +225,15 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	return result
 }
 
-func evalBlockStatement(
+func (in *Interpreter) evalBlockStatement(
 	block *ast.BlockStatement,
 	env *object.Environment,
 ) object.Object {
 	var result object.Object
 
+	in.hoistFunctions(block.Statements, env)
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = in.Eval(statement, env)
 
 		if result != nil {
 			rt := result.Type()
@@ -156,6 +246,24 @@ func evalBlockStatement(
 	return result
 }
 
+// binds the functions declared among stmts before any of them run, so they
+// can be called before their declaration and call each other
+func (in *Interpreter) hoistFunctions(stmts []ast.Statement, env *object.Environment) {
+	for _, stmt := range stmts {
+		if decl, ok := stmt.(*ast.FunctionDeclaration); ok {
+			bind(env, decl.Function.Name, in.Eval(decl.Function, env))
+		}
+	}
+}
+
+// binds ident to val in env, in the slot the resolver gave it if there is one
+func bind(env *object.Environment, ident *ast.Identifier, val object.Object) {
+	if ident.Slot != nil && ident.Slot.Depth == 0 && env.SetSlot(ident.Slot.Index, val) {
+		return
+	}
+	env.Set(ident.Value, val)
+}
+
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return TRUE
@@ -170,7 +278,7 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
 	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return newError(object.TYPE_ERROR, "unknown operator: %s%s", operator, right.Type())
 	}
 }
 
@@ -188,10 +296,10 @@ func evalInfixExpression(
 	case operator == "!=":
 		return nativeBoolToBooleanObject(left != right)
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s",
+		return newError(object.TYPE_ERROR, "type mismatch: %s %s %s",
 			left.Type(), operator, right.Type())
 	default:
-		return newError("unknown operator: %s %s %s",
+		return newError(object.TYPE_ERROR, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
@@ -211,11 +319,11 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+		return newError(object.TYPE_ERROR, "unknown operator: -%s", right.Type())
 	}
 
 	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	return newInteger(-value)
 }
 
 func evalIntegerInfixExpression(
@@ -227,13 +335,16 @@ func evalIntegerInfixExpression(
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		return newInteger(leftVal + rightVal)
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		return newInteger(leftVal - rightVal)
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		return newInteger(leftVal * rightVal)
 	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+		if rightVal == 0 {
+			return newError(object.DIVISION_ERROR, "division by zero: %d / 0", leftVal)
+		}
+		return newInteger(leftVal / rightVal)
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
@@ -243,7 +354,7 @@ func evalIntegerInfixExpression(
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s %s %s",
+		return newError(object.TYPE_ERROR, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
@@ -252,47 +363,86 @@ func evalStringInfixExpression(
 	operator string,
 	left, right object.Object,
 ) object.Object {
-	if operator != "+" {
-		return newError("unknown operator: %s %s %s",
-			left.Type(), operator, right.Type())
-	}
-
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError(object.TYPE_ERROR, "unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
 }
 
-func evalIfExpression(
+func (in *Interpreter) evalIfExpression(
 	ie *ast.IfExpression,
 	env *object.Environment,
 ) object.Object {
-	condition := Eval(ie.Condition, env)
+	condition := in.Eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return valueOf(in.Eval(ie.Consequence, env))
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return valueOf(in.Eval(ie.Alternative, env))
 	} else {
 		return NULL
 	}
 }
 
-func evalIdentifier(
+func (in *Interpreter) evalTryExpression(
+	te *ast.TryExpression,
+	env *object.Environment,
+) object.Object {
+	result := in.Eval(te.Block, env)
+
+	if err, ok := result.(*object.Error); ok && te.Catch != nil {
+		catchEnv := object.NewSlottedEnclosedEnvironment(env, te.CatchLocals)
+		bind(catchEnv, te.CatchParam, caughtValue(err))
+		result = in.Eval(te.Catch, catchEnv)
+	}
+
+	// an error or return inside finally replaces whatever happened before it
+	if te.Finally != nil {
+		finally := in.Eval(te.Finally, env)
+		if finally != nil {
+			rt := finally.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return finally
+			}
+		}
+	}
+
+	return valueOf(result)
+}
+
+func (in *Interpreter) evalIdentifier(
 	node *ast.Identifier,
 	env *object.Environment,
 ) object.Object {
+	// an empty slot means the binding hasn't been made yet, and the name
+	// may still be bound further out
+	if node.Slot != nil {
+		if val, ok := env.GetSlot(node.Slot.Depth, node.Slot.Index); ok {
+			return val
+		}
+	}
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin, ok := in.builtins[node.Value]; ok {
 		return builtin
 	}
 
-	return newError("identifier not found: " + node.Value)
+	return newError(object.NAME_ERROR, "identifier not found: %s", node.Value)
 }
 
 func isTruthy(obj object.Object) bool {
@@ -308,8 +458,43 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+func newError(kind string, format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
+
+// wraps a thrown value so it propagates like any other error. Throwing a
+// caught error hash again keeps its original message.
+func newThrownError(val object.Object) *object.Error {
+	message := val.Inspect()
+
+	if hash, ok := val.(*object.Hash); ok {
+		key := &object.String{Value: "message"}
+		if pair, ok := hash.Pairs[key.HashKey()]; ok {
+			message = pair.Value.Inspect()
+		}
+	}
+
+	return &object.Error{Message: message, Value: val}
+}
+
+// returns what a catch clause binds for err: the thrown value itself, or a
+// hash with the message and kind, as "type", of an error raised by the
+// interpreter
+func caughtValue(err *object.Error) object.Object {
+	if err.Value != nil {
+		return err.Value
+	}
+
+	pairs := make(map[object.HashKey]object.HashPair)
+	for key, value := range map[string]string{
+		"message": err.Message,
+		"type":    err.Kind,
+	} {
+		k := &object.String{Value: key}
+		pairs[k.HashKey()] = object.HashPair{Key: k, Value: &object.String{Value: value}}
+	}
+
+	return &object.Hash{Pairs: pairs}
 }
 
 func isError(obj object.Object) bool {
@@ -319,14 +504,14 @@ func isError(obj object.Object) bool {
 	return false
 }
 
-func evalExpressions(
+func (in *Interpreter) evalExpressions(
 	exps []ast.Expression,
 	env *object.Environment,
 ) []object.Object {
-	var result []object.Object
+	result := make([]object.Object, 0, len(exps))
 
 	for _, e := range exps {
-		evaluated := Eval(e, env)
+		evaluated := in.Eval(e, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -336,33 +521,136 @@ func evalExpressions(
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func (in *Interpreter) applyFunction(
+	call *ast.CallExpression,
+	env *object.Environment,
+	fn object.Object,
+	args []object.Object,
+) object.Object {
 	switch fn := fn.(type) {
 
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		extendedEnv, err := in.extendFunctionEnv(fn, args)
+		if err != nil {
+			return err
+		}
+
+		in.frames = append(in.frames, Frame{
+			Function: fn,
+			Env:      extendedEnv,
+			Call:     call,
+			CallFile: in.File,
+			CallEnv:  env,
+		})
+		in.File = fn.File
+		if in.profile != nil {
+			in.profile.enter(in.profile.monkeFunction(fn))
+		}
+		defer func() {
+			if in.profile != nil {
+				in.profile.exit()
+			}
+			in.File = in.frames[len(in.frames)-1].CallFile
+			in.frames = in.frames[:len(in.frames)-1]
+		}()
+
+		evaluated := in.Eval(fn.Body, extendedEnv)
+		return valueOf(unwrapReturnValue(evaluated))
 
 	case *object.Builtin:
-		return fn.Fn(args...)
+		if in.profile == nil {
+			return fn.Fn(args...)
+		}
+
+		in.profile.enter(in.profile.function(fn, fn.Name, "", 0, true))
+		result := fn.Fn(args...)
+		in.profile.builtinResult(result, args)
+		in.profile.exit()
+		return result
 
 	default:
-		return newError("not a function: %s", fn.Type())
+		return newError(object.TYPE_ERROR, "not a function: %s", fn.Type())
 	}
 }
 
-func extendFunctionEnv(
+// binds the arguments of a call to fn's parameters. Missing arguments take
+// their parameter's default, which is evaluated in the new environment so it
+// can refer to the parameters before it. Extra arguments go to the rest
+// parameter as an array.
+func (in *Interpreter) extendFunctionEnv(
 	fn *object.Function,
 	args []object.Object,
-) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+) (*object.Environment, *object.Error) {
+	if err := checkFunctionArity(fn, len(args)); err != nil {
+		return nil, err
+	}
+
+	var env *object.Environment
+	if fn.Locals != nil {
+		env = object.NewSlottedEnclosedEnvironment(fn.Env, fn.Locals)
+	} else {
+		size := len(fn.Parameters)
+		if fn.Rest != nil {
+			size++
+		}
+		env = object.NewSizedEnclosedEnvironment(fn.Env, size)
+	}
 
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		if paramIdx < len(args) {
+			bind(env, param, args[paramIdx])
+			continue
+		}
+
+		val := in.Eval(fn.Defaults[paramIdx], env)
+		if err, ok := val.(*object.Error); ok {
+			return nil, err
+		}
+		bind(env, param, val)
 	}
 
-	return env
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		bind(env, fn.Rest, &object.Array{Elements: rest})
+	}
+
+	return env, nil
+}
+
+func checkFunctionArity(fn *object.Function, got int) *object.Error {
+	required := len(fn.Parameters)
+	for required > 0 && required <= len(fn.Defaults) && fn.Defaults[required-1] != nil {
+		required--
+	}
+
+	switch {
+	case got < required && fn.Rest != nil:
+		return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want at least %d", got, required)
+	case got < required:
+		return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=%s", got, arityRange(required, len(fn.Parameters)))
+	case got > len(fn.Parameters) && fn.Rest == nil:
+		return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=%s", got, arityRange(required, len(fn.Parameters)))
+	}
+	return nil
+}
+
+func arityRange(min, max int) string {
+	if min == max {
+		return fmt.Sprintf("%d", min)
+	}
+	return fmt.Sprintf("%d..%d", min, max)
+}
+
+// blocks that are empty or end in a statement without a value evaluate to
+// nothing, which is null wherever the block is used as a value
+func valueOf(obj object.Object) object.Object {
+	if obj == nil {
+		return NULL
+	}
+	return obj
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -380,7 +668,7 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return newError(object.TYPE_ERROR, "index operator not supported: %s", left.Type())
 	}
 }
 
@@ -396,24 +684,24 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrayObject.Elements[idx]
 }
 
-func evalHashLiteral(
+func (in *Interpreter) evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
 ) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 
 	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
+		key := in.Eval(keyNode, env)
 		if isError(key) {
 			return key
 		}
 
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+			return newError(object.TYPE_ERROR, "unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
+		value := in.Eval(valueNode, env)
 		if isError(value) {
 			return value
 		}
@@ -430,7 +718,7 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 
 	key, ok := index.(object.Hashable)
 	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+		return newError(object.TYPE_ERROR, "unusable as hash key: %s", index.Type())
 	}
 
 	pair, ok := hashObject.Pairs[key.HashKey()]
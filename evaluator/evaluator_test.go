@@ -1,9 +1,12 @@
 package evaluator
 
 import (
+	"io/ioutil"
 	"monke/lexer"
 	"monke/object"
 	"monke/parser"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -59,6 +62,10 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"a" + "b" != "ab"`, false},
 	}
 
 	for _, tt := range tests {
@@ -98,6 +105,9 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (1 > 2) { 10 }", nil},
 		{"if (1 > 2) { 10 } else { 20 }", 20},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{`if (true) { {"a": 10}["a"] }`, 10},
+		{"if (true) { }", nil},
+		{"if (false) { 10 } else { let x = 1; }", nil},
 	}
 
 	for _, tt := range tests {
@@ -177,6 +187,10 @@ func TestErrorHandling(t *testing.T) {
 			"-true",
 			"unknown operator: -BOOLEAN",
 		},
+		{
+			"let zero = 0; 10 / zero",
+			"division by zero: 10 / 0",
+		},
 		{
 			"true + false;",
 			"unknown operator: BOOLEAN + BOOLEAN",
@@ -274,13 +288,55 @@ func TestFunctionObject(t *testing.T) {
 		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
 	}
 
-	expectedBody := "(x + 2)"
+	expectedBody := "{ (x + 2) }"
 
 	if fn.Body.String() != expectedBody {
 		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
 	}
 }
 
+func TestFunctionDeclarations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"fn double(x) { x * 2 }; double(4)", 8},
+		{"fn fact(n) { if (n < 2) { return 1 }; n * fact(n - 1) }; fact(5)", 120},
+		{"let x = twice(3); fn twice(n) { n * 2 }; x", 6},
+		{"fn even(n) { if (n == 0) { true } else { odd(n - 1) } }; fn odd(n) { if (n == 0) { false } else { even(n - 1) } }; if (even(4)) { 1 } else { 0 }", 1},
+		{"let f = fn() { return g(); fn g() { 7 } }; f()", 7},
+		{"if (true) { fn h() { 3 }; h() }", 3},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFunctionNames(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn add(a, b) { a + b }; add", "fn add(a, b) { (a + b) }"},
+		{"let sub = fn(a, b) { a - b }; sub", "fn sub(a, b) { (a - b) }"},
+		{"fn first() { 1 }; let second = first; second", "fn first() { 1 }"},
+		{"fn(x) { x }", "fn(x) { x }"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		fn, ok := evaluated.(*object.Function)
+		if !ok {
+			t.Errorf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if fn.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect for %q. expected=%q, got=%q", tt.input, tt.expected, fn.Inspect())
+		}
+	}
+}
+
 func TestFunctionApplication(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -299,6 +355,94 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestSmallIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+		shared   bool
+	}{
+		{"0", 0, true},
+		{"1000 + 23", SMALL_INT_MAX, true},
+		{"1000 + 24", SMALL_INT_MAX + 1, false},
+		{"-128", SMALL_INT_MIN, true},
+		{"-129", SMALL_INT_MIN - 1, false},
+		{"2 * 3", 6, true},
+		{`len("monke")`, 5, true},
+		{"100000", 100000, false},
+	}
+
+	for _, tt := range tests {
+		first := testEval(tt.input)
+		second := testEval(tt.input)
+		testIntegerObject(t, first, tt.expected)
+		if (first == second) != tt.shared {
+			t.Errorf("%s - expected shared=%t, got %t", tt.input, tt.shared, first == second)
+		}
+	}
+}
+
+func TestValuelessBodies(t *testing.T) {
+	tests := []string{
+		"fn() { }()",
+		"fn() { let x = 1; }()",
+		"fn() { fn inner() { } }()",
+		"try { } catch (e) { }",
+		"try { throw 1 } catch (e) { let x = e; }",
+		"let f = fn() { }; [f()][0]",
+		"let f = fn() { }; first([f()])",
+	}
+
+	for _, input := range tests {
+		testNullObject(t, testEval(input))
+	}
+}
+
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let add = fn(x, y = 10) { x + y }; add(1)", 11},
+		{"let add = fn(x, y = 10) { x + y }; add(1, 2)", 3},
+		{"let f = fn(x, y = x * 2) { y }; f(4)", 8},
+		{"let f = fn(x = 1, y = 2) { x * 10 + y }; f()", 12},
+		{"let count = fn(...args) { len(args) }; count()", 0},
+		{"let count = fn(...args) { len(args) }; count(1, 2, 3)", 3},
+		{"let f = fn(first, ...rest) { first + len(rest) }; f(10, 20, 30)", 12},
+		{"let f = fn(first, ...rest) { rest }; f(1, 2)[0]", 2},
+		{"let f = fn(a, b = 5, ...c) { a + b + len(c) }; f(1)", 6},
+		{"let f = fn(x = y) { x }; f()", "identifier not found: y"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestWrongNumberOfArguments(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"let add = fn(x, y) { x + y }; add(1)", "wrong number of arguments. got=1, want=2"},
+		{"let add = fn(x, y) { x + y }; add(1, 2, 3)", "wrong number of arguments. got=3, want=2"},
+		{"fn() { 1 }(1)", "wrong number of arguments. got=1, want=0"},
+		{"let f = fn(x, y = 1) { x }; f()", "wrong number of arguments. got=0, want=1..2"},
+		{"let f = fn(x, y = 1) { x }; f(1, 2, 3)", "wrong number of arguments. got=3, want=1..2"},
+		{"let f = fn(x, ...rest) { x }; f()", "wrong number of arguments. got=0, want at least 1"},
+	}
+
+	for _, tt := range tests {
+		testErrorObject(t, testEval(tt.input), tt.expectedMessage)
+	}
+}
+
 func TestEnclosingEnvironments(t *testing.T) {
 	input := `
 let first = 10;
@@ -328,6 +472,46 @@ addTwo(2);`
 	testIntegerObject(t, testEval(input), 4)
 }
 
+// bindings the resolver gave slots must be found just as they would be by
+// name, including before they are made
+func TestSlotLookup(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let add = fn(a) { fn(b) { fn(c) { a + b + c } } }; add(1)(2)(3)", 6},
+		{"fn fib(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)", 610},
+		{"fn f(len) { len + 1 }; f(1)", 2},
+		{"let f = fn(x) { len([x]) }; f(1)", 1},
+		{"fn f(c) { if (c) { let y = 1 }; y }; f(true)", 1},
+		{"fn f(c) { if (c) { let y = 1 }; y }; f(false)", "identifier not found: y"},
+		{"let x = 1; fn f() { let g = fn() { x }; let before = g(); let x = 10; before + g() }; f()", 11},
+		{"fn f() { fn g() { let h = fn() { x }; let x = 2; h() }; let x = 1; g() }; f()", 2},
+		{"fn f() { let h = fn() { x }; let x = 1; fn() { let x = 2; h() } }; f()()", 1},
+		{"fn f(a) { try { throw a } catch (e) { let b = e + 1; fn() { a + b } } }; f(1)()", 3},
+		{"fn f(a, b = if (a > 0) { let t = a * 2; t } else { 0 }) { b + t }; f(2)", 8},
+		{"fn f(a, ...rest) { fn g() { len(rest) + a }; g() }; f(1, 2, 3)", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			err, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%s - expected an error, got %T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if err.Message != expected {
+				t.Errorf("wrong error message. want=%q, got=%q", expected, err.Message)
+			}
+		}
+	}
+}
+
 func TestStringLiteral(t *testing.T) {
 	input := `"Hello World!"`
 
@@ -582,6 +766,80 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+func TestTryCatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { 10 } catch (e) { 20 }`, 10},
+		{`try { throw 5; 10 } catch (e) { e * 2 }`, 10},
+		{`try { foobar } catch (e) { e["message"] }`, "identifier not found: foobar"},
+		{`try { 5 + true } catch (e) { e["type"] }`, "TypeError"},
+		{`try { -"a" } catch (e) { e["type"] }`, "TypeError"},
+		{`try { 1(2) } catch (e) { e["type"] }`, "TypeError"},
+		{`try { len(1) } catch (e) { e["type"] }`, "TypeError"},
+		{`try { foobar } catch (e) { e["type"] }`, "NameError"},
+		{`try { 1 / 0 } catch (e) { e["type"] }`, "DivisionByZeroError"},
+		{`try { fn(x) { x }() } catch (e) { e["type"] }`, "ArgumentError"},
+		{`try { len() } catch (e) { e["type"] }`, "ArgumentError"},
+		{`try { import "missing.grr" } catch (e) { e["type"] }`, "ImportError"},
+		{`try { throw { "type": "Mine" } } catch (e) { e["type"] }`, "Mine"},
+		{`try { try { 1 / 0 } catch (e) { throw e } } catch (e) { e["type"] }`, "DivisionByZeroError"},
+		{`let f = fn() { throw "boom" }; try { f() } catch (e) { e }`, "boom"},
+		{`let x = 1; try { x } finally { let x = 2; }; x`, 2},
+		{`let e = 1; try { throw 2 } catch (e) { e }; e`, 1},
+		{`try { throw 1 } catch (e) { 2 } finally { 3 }`, 2},
+		{`let f = fn() { try { return 1 } finally { return 2 } }; f()`, 2},
+		{`try { try { throw 1 } catch (e) { throw e + 1 } } catch (e) { e }`, 2},
+		{`try { try { foobar } catch (e) { throw e } } catch (e) { e["message"] }`, "identifier not found: foobar"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+			}
+		}
+	}
+}
+
+func TestUncaughtThrow(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`throw "boom"; 5`, "boom"},
+		{`try { throw "boom" } finally { 1 }`, "boom"},
+		{`try { 1 } catch (e) { 2 } finally { throw "late" }`, "late"},
+		{`try { throw 1 } catch (e) { foobar }`, "identifier not found: foobar"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -627,3 +885,112 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 	}
 	return true
 }
+
+// benchmarkProgram is one of the programs in testdata/bench at the root of
+// the repository
+type benchmarkProgram struct {
+	name   string
+	source string
+}
+
+func benchmarkPrograms(b *testing.B) []benchmarkProgram {
+	files, err := filepath.Glob(filepath.Join("..", "testdata", "bench", "*.grr"))
+	if err != nil || len(files) == 0 {
+		b.Fatalf("no benchmark programs: %v", err)
+	}
+
+	var programs []benchmarkProgram
+	for _, file := range files {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+		name := strings.TrimSuffix(filepath.Base(file), ".grr")
+		programs = append(programs, benchmarkProgram{name, string(source)})
+	}
+	return programs
+}
+
+// Each run evaluates the whole program in a fresh environment.
+func BenchmarkEval(b *testing.B) {
+	for _, program := range benchmarkPrograms(b) {
+		parsed := parser.New(lexer.New(program.source)).ParseProgram()
+		b.Run(program.name, func(b *testing.B) {
+			in := New()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if result := in.Eval(parsed, object.NewEnvironment()); isError(result) {
+					b.Fatal(result.Inspect())
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFunctionCall(b *testing.B) {
+	env := object.NewEnvironment()
+	in := New()
+	in.Eval(parser.New(lexer.New("let add = fn(a, b) { a + b };")).ParseProgram(), env)
+	call := parser.New(lexer.New("add(1, 2)")).ParseProgram()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		in.Eval(call, env)
+	}
+}
+
+// looks up variables of closures nested five deep, by slot and by name
+func BenchmarkNestedClosure(b *testing.B) {
+	input := `
+let f = fn(a, b) { fn(c, d) { fn(e, f) { fn(g, h) { fn(i, j) {
+  let x = a + b + c + d + e + f + g + h + i + j;
+  x + a + c + e + g + i
+} } } } };
+let inner = f(1, 2)(3, 4)(5, 6)(7, 8);
+inner(9, 10)`
+
+	for _, slotted := range []bool{true, false} {
+		name := "slots"
+		if !slotted {
+			name = "names"
+		}
+		b.Run(name, func(b *testing.B) {
+			program := parser.New(lexer.New(input)).ParseProgram()
+			// a program marked as slotted that wasn't is looked up by name
+			program.Slotted = !slotted
+			in := New()
+			env := object.NewEnvironment()
+			in.Eval(program, env)
+			call := program.Statements[len(program.Statements)-1]
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				in.Eval(call, env)
+			}
+		})
+	}
+}
+
+func BenchmarkInfixExpression(b *testing.B) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"integers", "1 + 2 * 3 - 4 / 2 < 10 == true"},
+		{"strings", `"mon" + "ke" + "y"`},
+		{"booleans", "true == false != true"},
+	}
+
+	for _, tt := range tests {
+		expression := parser.New(lexer.New(tt.input)).ParseProgram()
+		b.Run(tt.name, func(b *testing.B) {
+			in := New()
+			env := object.NewEnvironment()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				in.Eval(expression, env)
+			}
+		})
+	}
+}
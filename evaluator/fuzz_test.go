@@ -0,0 +1,33 @@
+//go:build go1.18
+// +build go1.18
+
+package evaluator
+
+import (
+	"io/ioutil"
+	"monke/lexer"
+	"monke/object"
+	"monke/parser"
+	"strings"
+	"testing"
+)
+
+// Evaluating a program never panics, and the step budget keeps programs that
+// loop or recurse forever from hanging the fuzzer. The seeds are in
+// testdata/fuzz/FuzzEval.
+func FuzzEval(f *testing.F) {
+	f.Fuzz(func(t *testing.T, input string) {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return
+		}
+
+		in := New()
+		in.MaxSteps = 10000
+		in.Stdin = strings.NewReader("")
+		in.Stdout, in.Stderr = ioutil.Discard, ioutil.Discard
+		in.Dir = t.TempDir()
+		in.Eval(program, object.NewEnvironment())
+	})
+}
@@ -0,0 +1,244 @@
+package evaluator
+
+import (
+	"bufio"
+	"io"
+	"monke/ast"
+	"monke/object"
+	"os"
+	"sort"
+)
+
+// VARIADIC can be passed as the arity to Register for builtins that accept
+// any number of arguments.
+const VARIADIC = object.VARIADIC
+
+// Interpreter holds everything a single evaluation context needs apart from
+// the environment itself. Each host program gets its own set of builtins, so
+// registering or removing one never affects other interpreters.
+//
+// Stdin and Stdout are the streams the I/O builtins use, and Stderr is where
+// hosts report the errors programs end with. They default to the process
+// streams and can be replaced by the host at any time.
+type Interpreter struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Dir is the directory relative imports are resolved against. An empty
+	// Dir means the working directory.
+	Dir string
+
+	// File is the path of the file the code being evaluated comes from, or
+	// empty if it didn't come from a file. The host sets it for the program
+	// it runs; imports and calls switch it to the file of the code they run
+	// for as long as that runs.
+	File string
+
+	// Hook, if set, is called before every statement and expression is
+	// evaluated. Debuggers use it to pause the program.
+	Hook func(node ast.Node, env *object.Environment)
+
+	// MaxSteps, if not 0, is how many statements and expressions each call
+	// of Eval or Call by the host may evaluate before it ends with an error,
+	// so hosts can run programs that might never finish. Steps counts them
+	// while MaxSteps is set, starting over at every such call.
+	MaxSteps int
+	Steps    int
+	// whether an Eval or Call by the host is under way, as opposed to one
+	// nested in it
+	running bool
+
+	builtins map[string]*object.Builtin
+	// modules caches imported files by absolute path, loading is the chain of
+	// files currently being imported and is used to detect cycles
+	modules map[string]object.Object
+	loading []string
+	// stdin buffers Stdin for line based builtins. It is rebuilt whenever the
+	// host swaps Stdin for a different reader.
+	stdin    *bufio.Reader
+	stdinSrc io.Reader
+	// the calls that haven't returned yet, innermost last
+	frames []Frame
+	// the profile being recorded and the statements being counted, if any
+	profile  *Profile
+	coverage *Coverage
+}
+
+// Frame is a call to a Monke function that hasn't returned yet.
+type Frame struct {
+	Function *object.Function
+	Env      *object.Environment // the function's own environment
+	// where the function was called from: the call expression, the file
+	// it's in and the environment it was evaluated in. Call and CallEnv are
+	// nil for functions the host called with Call.
+	Call     *ast.CallExpression
+	CallFile string
+	CallEnv  *object.Environment
+}
+
+// Stack returns the calls currently being evaluated, outermost first.
+func (in *Interpreter) Stack() []Frame {
+	stack := make([]Frame, len(in.frames))
+	copy(stack, in.frames)
+	return stack
+}
+
+// Depth returns how many calls are currently being evaluated.
+func (in *Interpreter) Depth() int {
+	return len(in.frames)
+}
+
+// Call calls fn, a Monke function or a builtin, with args. Builtins use it
+// to call the functions they are passed.
+func (in *Interpreter) Call(fn object.Object, args ...object.Object) object.Object {
+	if in.MaxSteps > 0 && !in.running {
+		in.running, in.Steps = true, 0
+		defer func() { in.running = false }()
+	}
+	return in.applyFunction(nil, nil, fn, args)
+}
+
+// creates a new Interpreter with the default builtins registered
+func New() *Interpreter {
+	in := &Interpreter{
+		Stdin:    os.Stdin,
+		Stdout:   os.Stdout,
+		Stderr:   os.Stderr,
+		builtins: make(map[string]*object.Builtin),
+		modules:  make(map[string]object.Object),
+	}
+	in.registerDefaultBuiltins()
+	return in
+}
+
+// returns a buffered reader over Stdin, reusing it if the host already passed
+// one in so no input gets lost between the host and the builtins
+func (in *Interpreter) stdinReader() *bufio.Reader {
+	if in.stdin == nil || in.stdinSrc != in.Stdin {
+		if br, ok := in.Stdin.(*bufio.Reader); ok {
+			in.stdin = br
+		} else {
+			in.stdin = bufio.NewReader(in.Stdin)
+		}
+		in.stdinSrc = in.Stdin
+	}
+	return in.stdin
+}
+
+// Register makes fn callable from Monke code as name. If arity is not
+// VARIADIC, calls with a different number of arguments are rejected with an
+// error before fn runs. Registering an existing name shadows it.
+func (in *Interpreter) Register(name string, arity int, fn object.BuiltinFunction) {
+	in.builtins[name] = &object.Builtin{Name: name, Arity: arity, Fn: checkArity(arity, fn)}
+}
+
+// Unregister removes the builtin called name, if any. This is how hosts
+// sandbox programs, e.g. by dropping `puts`.
+func (in *Interpreter) Unregister(name string) {
+	delete(in.builtins, name)
+}
+
+// Builtins returns the names of all registered builtins in sorted order.
+func (in *Interpreter) Builtins() []string {
+	names := make([]string, 0, len(in.builtins))
+	for name := range in.builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Builtin returns the builtin registered as name.
+func (in *Interpreter) Builtin(name string) (*object.Builtin, bool) {
+	builtin, ok := in.builtins[name]
+	return builtin, ok
+}
+
+func checkArity(arity int, fn object.BuiltinFunction) object.BuiltinFunction {
+	if arity == VARIADIC {
+		return fn
+	}
+
+	return func(args ...object.Object) object.Object {
+		if len(args) != arity {
+			return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=%d",
+				len(args), arity)
+		}
+		return fn(args...)
+	}
+}
+
+// IntegerArg returns args[idx] as an Integer, or an error naming the builtin
+// fn if it has a different type.
+func IntegerArg(fn string, args []object.Object, idx int) (*object.Integer, *object.Error) {
+	arg, err := typedArg(fn, args, idx, object.INTEGER_OBJ)
+	if err != nil {
+		return nil, err
+	}
+	return arg.(*object.Integer), nil
+}
+
+// StringArg returns args[idx] as a String, or an error naming the builtin fn
+// if it has a different type.
+func StringArg(fn string, args []object.Object, idx int) (*object.String, *object.Error) {
+	arg, err := typedArg(fn, args, idx, object.STRING_OBJ)
+	if err != nil {
+		return nil, err
+	}
+	return arg.(*object.String), nil
+}
+
+// BooleanArg returns args[idx] as a Boolean, or an error naming the builtin
+// fn if it has a different type.
+func BooleanArg(fn string, args []object.Object, idx int) (*object.Boolean, *object.Error) {
+	arg, err := typedArg(fn, args, idx, object.BOOLEAN_OBJ)
+	if err != nil {
+		return nil, err
+	}
+	return arg.(*object.Boolean), nil
+}
+
+// ArrayArg returns args[idx] as an Array, or an error naming the builtin fn
+// if it has a different type.
+func ArrayArg(fn string, args []object.Object, idx int) (*object.Array, *object.Error) {
+	arg, err := typedArg(fn, args, idx, object.ARRAY_OBJ)
+	if err != nil {
+		return nil, err
+	}
+	return arg.(*object.Array), nil
+}
+
+// HashArg returns args[idx] as a Hash, or an error naming the builtin fn if
+// it has a different type.
+func HashArg(fn string, args []object.Object, idx int) (*object.Hash, *object.Error) {
+	arg, err := typedArg(fn, args, idx, object.HASH_OBJ)
+	if err != nil {
+		return nil, err
+	}
+	return arg.(*object.Hash), nil
+}
+
+func typedArg(
+	fn string,
+	args []object.Object,
+	idx int,
+	want object.ObjectType,
+) (object.Object, *object.Error) {
+	if idx >= len(args) {
+		return nil, newError(object.ARGUMENT_ERROR, "missing argument %d to `%s`", idx+1, fn)
+	}
+
+	if args[idx].Type() != want {
+		return nil, newError(object.TYPE_ERROR, "argument to `%s` must be %s, got %s",
+			fn, want, args[idx].Type())
+	}
+
+	return args[idx], nil
+}
+
+// Errorf builds an error object that builtins can return to Monke code. Its
+// kind is object.RUNTIME_ERROR; set Kind to say what went wrong.
+func Errorf(format string, a ...interface{}) *object.Error {
+	return newError(object.RUNTIME_ERROR, format, a...)
+}
@@ -0,0 +1,234 @@
+package evaluator
+
+import (
+	"bytes"
+	"io/ioutil"
+	"monke/ast"
+	"monke/lexer"
+	"monke/object"
+	"monke/parser"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegisterBuiltin(t *testing.T) {
+	in := New()
+	in.Register("double", 1, func(args ...object.Object) object.Object {
+		n, err := IntegerArg("double", args, 0)
+		if err != nil {
+			return err
+		}
+		return &object.Integer{Value: n.Value * 2}
+	})
+
+	testIntegerObject(t, testEvalWith(in, "double(21)"), 42)
+
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"double()", "wrong number of arguments. got=0, want=1"},
+		{"double(1, 2)", "wrong number of arguments. got=2, want=1"},
+		{`double("x")`, "argument to `double` must be INTEGER, got STRING"},
+	}
+
+	for _, tt := range tests {
+		testErrorObject(t, testEvalWith(in, tt.input), tt.expectedMessage)
+	}
+
+	if builtin, ok := in.Builtin("double"); !ok || builtin.Arity != 1 {
+		t.Errorf("double should have arity 1, got %+v", builtin)
+	}
+	if builtin, _ := in.Builtin("puts"); builtin.Arity != VARIADIC {
+		t.Errorf("puts should be variadic, got arity %d", builtin.Arity)
+	}
+}
+
+func TestRegisterIsPerInterpreter(t *testing.T) {
+	in := New()
+	in.Register("answer", 0, func(args ...object.Object) object.Object {
+		return &object.Integer{Value: 42}
+	})
+
+	testIntegerObject(t, testEvalWith(in, "answer()"), 42)
+	testErrorObject(t, testEvalWith(New(), "answer()"),
+		"identifier not found: answer")
+	testErrorObject(t, testEval("answer()"), "identifier not found: answer")
+}
+
+func TestShadowAndUnregisterBuiltins(t *testing.T) {
+	in := New()
+	in.Register("len", VARIADIC, func(args ...object.Object) object.Object {
+		return &object.Integer{Value: int64(len(args))}
+	})
+	in.Unregister("puts")
+
+	testIntegerObject(t, testEvalWith(in, `len("a", "b", "c")`), 3)
+	testErrorObject(t, testEvalWith(in, `puts("hi")`),
+		"identifier not found: puts")
+
+	// the default builtins are untouched
+	testIntegerObject(t, testEval(`len("abc")`), 3)
+
+	for _, name := range in.Builtins() {
+		in.Unregister(name)
+	}
+	if len(in.Builtins()) != 0 {
+		t.Fatalf("builtins not removed. got=%v", in.Builtins())
+	}
+}
+
+func TestRedirectedStreams(t *testing.T) {
+	var out bytes.Buffer
+	in := New()
+	in.Stdout = &out
+	in.Stdin = strings.NewReader("Alice\r\nBob")
+
+	input := `
+let first = gets();
+let second = gets();
+puts("hello " + first, "hello " + second);
+gets();`
+
+	testNullObject(t, testEvalWith(in, input))
+
+	expected := "hello Alice\nhello Bob\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestHook(t *testing.T) {
+	in := New()
+	var statements []string
+	in.Hook = func(node ast.Node, env *object.Environment) {
+		if _, ok := node.(ast.Statement); ok {
+			statements = append(statements, node.String())
+		}
+	}
+
+	testIntegerObject(t, testEvalWith(in, "let x = 1; x + 1"), 2)
+
+	expected := []string{"let x = 1;", "(x + 1)"}
+	if strings.Join(statements, "|") != strings.Join(expected, "|") {
+		t.Errorf("hook saw the wrong statements. expected=%q, got=%q", expected, statements)
+	}
+}
+
+func TestStack(t *testing.T) {
+	in := New()
+	in.File = "main.grr"
+
+	var stack []Frame
+	in.Register("snapshot", 0, func(args ...object.Object) object.Object {
+		stack = in.Stack()
+		return NULL
+	})
+
+	testEvalWith(in, "fn outer(a) { inner(a + 1) }; fn inner(b) { snapshot() }; outer(1)")
+
+	if len(stack) != 2 {
+		t.Fatalf("expected 2 frames, got %d", len(stack))
+	}
+	for i, name := range []string{"outer", "inner"} {
+		if stack[i].Function.Name != name {
+			t.Errorf("frame %d is %q, expected %q", i, stack[i].Function.Name, name)
+		}
+		if stack[i].CallFile != "main.grr" {
+			t.Errorf("frame %d was called from %q", i, stack[i].CallFile)
+		}
+	}
+	if b, _ := stack[1].Env.Get("b"); b == nil || b.Inspect() != "2" {
+		t.Errorf("expected b = 2 in the inner frame, got %v", b)
+	}
+	if in.Depth() != 0 {
+		t.Errorf("calls left on the stack after returning: %d", in.Depth())
+	}
+}
+
+func testEvalWith(in *Interpreter, input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	return in.Eval(program, env)
+}
+
+func testErrorObject(t *testing.T, obj object.Object, expected string) bool {
+	errObj, ok := obj.(*object.Error)
+	if !ok {
+		t.Errorf("object is not Error. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q",
+			expected, errObj.Message)
+		return false
+	}
+	return true
+}
+
+func TestCall(t *testing.T) {
+	in := New()
+	in.Register("apply", 2, func(args ...object.Object) object.Object {
+		return in.Call(args[0], args[1])
+	})
+
+	testIntegerObject(t, testEvalWith(in, "apply(fn(x) { x * 2 }, 21)"), 42)
+	testIntegerObject(t, testEvalWith(in, `apply(len, "four")`), 4)
+	testErrorObject(t, testEvalWith(in, "apply(fn() { 1 }, 2)"), "wrong number of arguments. got=1, want=0")
+	testErrorObject(t, testEvalWith(in, "apply(1, 2)"), "not a function: INTEGER")
+	if in.Depth() != 0 {
+		t.Errorf("calls left on the stack after returning: %d", in.Depth())
+	}
+}
+
+func TestMaxSteps(t *testing.T) {
+	in := New()
+	in.MaxSteps = 1000
+
+	tests := []string{
+		"fn forever() { forever() }; forever()",
+		`fn forever() { forever() }; try { forever() } catch (e) { "caught" }`,
+		`fn forever() { try { forever() } finally { forever() } }; forever()`,
+	}
+
+	// each program gets a budget of its own
+	for _, input := range tests {
+		testErrorObject(t, testEvalWith(in, input), "step budget of 1000 exceeded")
+	}
+
+	env := object.NewEnvironment()
+	program := parser.New(lexer.New("let double = fn(x) { x * 2 }; double(21)")).ParseProgram()
+	testIntegerObject(t, in.Eval(program, env), 42)
+	if in.Steps == 0 || in.Steps > 20 {
+		t.Errorf("expected a handful of steps, got %d", in.Steps)
+	}
+	if in.Depth() != 0 {
+		t.Errorf("calls left on the stack after running out of steps: %d", in.Depth())
+	}
+
+	// and so does every function the host calls
+	double, _ := env.Get("double")
+	for i := 0; i < 200; i++ {
+		testIntegerObject(t, in.Call(double, &object.Integer{Value: 1}), 2)
+	}
+	if in.Steps == 0 || in.Steps > 10 {
+		t.Errorf("expected a handful of steps for one call, got %d", in.Steps)
+	}
+}
+
+// the package-level Eval shares nothing between calls, like the modules it
+// imported
+func TestEvalSharesNothing(t *testing.T) {
+	dir := writeModules(t, map[string]string{"lib.grr": "let value = 1;"})
+	input := `let lib = import "` + filepath.ToSlash(filepath.Join(dir, "lib.grr")) + `"; lib["value"]`
+
+	testIntegerObject(t, testEval(input), 1)
+	if err := ioutil.WriteFile(filepath.Join(dir, "lib.grr"), []byte("let value = 2;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testIntegerObject(t, testEval(input), 2)
+}
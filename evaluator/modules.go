@@ -0,0 +1,97 @@
+package evaluator
+
+import (
+	"io/ioutil"
+	"monke/ast"
+	"monke/lexer"
+	"monke/object"
+	"monke/parser"
+	"path/filepath"
+	"strings"
+)
+
+// evaluates an import expression. Every file is evaluated at most once per
+// Interpreter in its own environment; later imports of the same file get the
+// cached module back.
+func (in *Interpreter) evalImportExpression(ie *ast.ImportExpression) object.Object {
+	path := ie.Path.Value
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(in.Dir, path)
+	}
+
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return newError(object.IMPORT_ERROR, "could not import %q: %s", ie.Path.Value, err)
+	}
+
+	if module, ok := in.modules[path]; ok {
+		return module
+	}
+
+	for i, loading := range in.loading {
+		if loading == path {
+			cycle := []string{}
+			for _, p := range in.loading[i:] {
+				cycle = append(cycle, filepath.Base(p))
+			}
+			cycle = append(cycle, filepath.Base(path))
+			return newError(object.IMPORT_ERROR, "import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	in.loading = append(in.loading, path)
+	defer func() { in.loading = in.loading[:len(in.loading)-1] }()
+
+	module := in.loadModule(path)
+	if isError(module) {
+		return module
+	}
+
+	in.modules[path] = module
+	return module
+}
+
+// lexes, parses and evaluates the file at path and collects its exported
+// top-level bindings into a hash. Bindings starting with an underscore stay
+// private to the module.
+func (in *Interpreter) loadModule(path string) object.Object {
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		return newError(object.IMPORT_ERROR, "could not import %q: %s", path, err)
+	}
+
+	l := lexer.New(string(source))
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		errors := []string{}
+		for _, d := range p.Diagnostics() {
+			errors = append(errors, d.String())
+		}
+		return newError(object.IMPORT_ERROR, "could not import %q: %s", path, strings.Join(errors, "; "))
+	}
+
+	// imports inside the module are relative to the module itself
+	dir, file := in.Dir, in.File
+	in.Dir, in.File = filepath.Dir(path), path
+	defer func() { in.Dir, in.File = dir, file }()
+
+	env := object.NewEnvironment()
+	if result := in.Eval(program, env); isError(result) {
+		return result
+	}
+
+	pairs := make(map[object.HashKey]object.HashPair)
+	for _, name := range env.Names() {
+		if strings.HasPrefix(name, "_") {
+			continue
+		}
+
+		value, _ := env.Get(name)
+		key := &object.String{Value: name}
+		pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
@@ -0,0 +1,98 @@
+package evaluator
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportExpression(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"math.grr": `
+let _secret = 2;
+let double = fn(x) { x * _secret };
+let ten = 10;`,
+		"lib/util.grr":     `let inc = fn(x) { x + 1 };`,
+		"lib/reexport.grr": `let util = import "util.grr"; let plusTwo = fn(x) { util["inc"](util["inc"](x)) };`,
+	})
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let math = import "math.grr"; math["double"](math["ten"]);`, 20},
+		{`let math = import "math.grr"; math["_secret"];`, nil},
+		{`let r = import "lib/reexport.grr"; r["plusTwo"](1);`, 3},
+		{`import "lib/util.grr" == import "lib/util.grr"`, true},
+		{`import "missing.grr"`, "could not import"},
+	}
+
+	for _, tt := range tests {
+		in := New()
+		in.Dir = dir
+		evaluated := testEvalWith(in, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			if !isError(evaluated) {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestImportIsEvaluatedOnce(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"counter.grr": `puts("loading");`,
+	})
+
+	in := New()
+	in.Dir = dir
+	var out bytes.Buffer
+	in.Stdout = &out
+	testEvalWith(in, `import "counter.grr"; import "./counter.grr";`)
+
+	if out.String() != "loading\n" {
+		t.Errorf("module evaluated more than once. output=%q", out.String())
+	}
+}
+
+func TestImportCycle(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"a.grr": `let b = import "b.grr";`,
+		"b.grr": `let a = import "a.grr";`,
+	})
+
+	in := New()
+	in.Dir = dir
+	testErrorObject(t, testEvalWith(in, `import "a.grr"`),
+		"import cycle: a.grr -> b.grr -> a.grr")
+}
+
+func writeModules(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "monke-modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
@@ -0,0 +1,200 @@
+package evaluator
+
+import (
+	"monke/ast"
+	"monke/object"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Profile is where a program spent its time and which functions created the
+// most values, recorded between StartProfile and StopProfile.
+type Profile struct {
+	Start    time.Time
+	Duration time.Duration
+	// every function called, in the order of their first call. The top level
+	// of the program comes first.
+	Functions []*FunctionProfile
+	// the cost of the calls along each distinct call stack
+	Samples []*Sample
+
+	// functions are keyed by their body, which is unique to where they are
+	// defined, and builtins by themselves
+	functions map[interface{}]*FunctionProfile
+	samples   map[string]*Sample
+	stack     []profileFrame
+}
+
+// FunctionProfile is what all calls to one function cost. Functions are told
+// apart by where they are defined, so the closures one function literal
+// creates share their profile.
+type FunctionProfile struct {
+	ID      int    // starting at 1
+	Name    string // "(anonymous)" for functions without a name
+	File    string
+	Line    int // where the function is defined, 0 for builtins
+	Builtin bool
+
+	Calls int64
+	// time spent in the calls, with and without the calls they made in turn.
+	// Recursive calls only count once towards the inclusive time.
+	Inclusive time.Duration
+	Exclusive time.Duration
+	// values created by the function's own code, not counting the shared
+	// booleans, null and small integers
+	Allocations int64
+
+	active int // calls currently on the stack
+}
+
+// Sample is the cost of the calls made with the same call stack.
+type Sample struct {
+	Stack       []*FunctionProfile // the function called first, then its callers
+	Calls       int64
+	Time        time.Duration // not counting the calls made from it
+	Allocations int64
+}
+
+type profileFrame struct {
+	fn          *FunctionProfile
+	start       time.Time
+	children    time.Duration // spent in calls made from this one
+	allocations int64
+}
+
+// The key of the program's top level. Names in the profile are in
+// parentheses rather than angle brackets, which pprof doesn't show.
+type topLevel struct{}
+
+// StartProfile starts recording a profile of everything in evaluates, which
+// slows evaluation down. The top level of the program is attributed to
+// in.File, so set it first. A profile that was already being recorded is
+// thrown away.
+func (in *Interpreter) StartProfile() {
+	p := &Profile{
+		Start:     time.Now(),
+		functions: make(map[interface{}]*FunctionProfile),
+		samples:   make(map[string]*Sample),
+	}
+	p.enter(p.function(topLevel{}, "(top level)", in.File, 1, false))
+	in.profile = p
+}
+
+// StopProfile stops recording and returns the profile, or nil if none was
+// being recorded.
+func (in *Interpreter) StopProfile() *Profile {
+	p := in.profile
+	if p == nil {
+		return nil
+	}
+	in.profile = nil
+
+	for len(p.stack) > 0 {
+		p.exit()
+	}
+	p.Duration = time.Since(p.Start)
+	return p
+}
+
+// returns the profile of the function with the given key, creating it on the
+// first call
+func (p *Profile) function(key interface{}, name, file string, line int, builtin bool) *FunctionProfile {
+	fn, ok := p.functions[key]
+	if !ok {
+		fn = &FunctionProfile{ID: len(p.Functions) + 1, Name: name, File: file, Line: line, Builtin: builtin}
+		p.functions[key] = fn
+		p.Functions = append(p.Functions, fn)
+	}
+	return fn
+}
+
+// returns the profile of a Monke function
+func (p *Profile) monkeFunction(fn *object.Function) *FunctionProfile {
+	name := fn.Name
+	if name == "" {
+		name = "(anonymous)"
+	}
+	return p.function(fn.Body, name, fn.File, fn.Body.Token.Pos.Line, false)
+}
+
+func (p *Profile) enter(fn *FunctionProfile) {
+	fn.Calls++
+	fn.active++
+	p.stack = append(p.stack, profileFrame{fn: fn, start: time.Now()})
+}
+
+func (p *Profile) exit() {
+	frame := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+
+	elapsed := time.Since(frame.start)
+	self := elapsed - frame.children
+	fn := frame.fn
+
+	fn.active--
+	if fn.active == 0 {
+		fn.Inclusive += elapsed
+	}
+	fn.Exclusive += self
+	fn.Allocations += frame.allocations
+	if len(p.stack) > 0 {
+		p.stack[len(p.stack)-1].children += elapsed
+	}
+
+	// the key is the IDs along the stack, innermost first
+	var key strings.Builder
+	key.WriteString(strconv.Itoa(fn.ID))
+	for i := len(p.stack) - 1; i >= 0; i-- {
+		key.WriteString(",")
+		key.WriteString(strconv.Itoa(p.stack[i].fn.ID))
+	}
+
+	sample, ok := p.samples[key.String()]
+	if !ok {
+		stack := []*FunctionProfile{fn}
+		for i := len(p.stack) - 1; i >= 0; i-- {
+			stack = append(stack, p.stack[i].fn)
+		}
+		sample = &Sample{Stack: stack}
+		p.samples[key.String()] = sample
+		p.Samples = append(p.Samples, sample)
+	}
+	sample.Calls++
+	sample.Time += self
+	sample.Allocations += frame.allocations
+}
+
+// counts result towards the current function if evaluating node created it
+func (p *Profile) allocated(node ast.Node, result object.Object) {
+	switch node.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.ArrayLiteral, *ast.HashLiteral,
+		*ast.FunctionLiteral, *ast.PrefixExpression, *ast.InfixExpression:
+		if isShared(result) {
+			return
+		}
+		p.stack[len(p.stack)-1].allocations++
+	}
+}
+
+// counts the result of a builtin if it is a new value rather than one of
+// its arguments
+func (p *Profile) builtinResult(result object.Object, args []object.Object) {
+	if isShared(result) {
+		return
+	}
+	for _, arg := range args {
+		if arg == result {
+			return
+		}
+	}
+	p.stack[len(p.stack)-1].allocations++
+}
+
+// reports whether obj is one of the values every program shares
+func isShared(obj object.Object) bool {
+	if i, ok := obj.(*object.Integer); ok {
+		return i.Value >= SMALL_INT_MIN && i.Value <= SMALL_INT_MAX && i == &smallInts[i.Value-SMALL_INT_MIN]
+	}
+	return obj == nil || obj == TRUE || obj == FALSE || obj == NULL
+}
@@ -0,0 +1,75 @@
+package evaluator
+
+import (
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	in := New()
+	in.File = "main.grr"
+	in.StartProfile()
+	testEvalWith(in, `
+fn fact(n) { if (n < 2) { return 1 }; n * fact(n - 1) }
+let double = fn(x) { x * 2 };
+double(fact(7));
+push([1], 2000);
+`)
+	p := in.StopProfile()
+
+	if in.StopProfile() != nil {
+		t.Errorf("StopProfile returned a profile twice")
+	}
+
+	functions := map[string]*FunctionProfile{}
+	for _, fn := range p.Functions {
+		functions[fn.Name] = fn
+	}
+
+	tests := []struct {
+		name        string
+		calls       int64
+		line        int
+		builtin     bool
+		allocations int64
+	}{
+		// small integers are shared rather than created, so of the results of
+		// fact only 5040 counts
+		{"(top level)", 1, 1, false, 4},
+		{"fact", 7, 2, false, 1},
+		{"double", 1, 3, false, 1},
+		{"push", 1, 0, true, 1},
+	}
+
+	for _, tt := range tests {
+		fn, ok := functions[tt.name]
+		if !ok {
+			t.Errorf("no profile for %s", tt.name)
+			continue
+		}
+		if fn.Calls != tt.calls || fn.Line != tt.line || fn.Builtin != tt.builtin || fn.Allocations != tt.allocations {
+			t.Errorf("wrong profile for %s. expected calls=%d line=%d builtin=%t allocations=%d, got %+v",
+				tt.name, tt.calls, tt.line, tt.builtin, tt.allocations, fn)
+		}
+		if fn.Exclusive > fn.Inclusive {
+			t.Errorf("%s has more exclusive than inclusive time: %s > %s", tt.name, fn.Exclusive, fn.Inclusive)
+		}
+	}
+
+	if top := p.Functions[0]; top.Inclusive > p.Duration || top.File != "main.grr" {
+		t.Errorf("wrong top level profile %+v", top)
+	}
+
+	// the recursive calls of fact each have a stack of their own
+	var calls int64
+	for _, s := range p.Samples {
+		if s.Stack[0].Name == "fact" {
+			calls += s.Calls
+			if last := s.Stack[len(s.Stack)-1]; last.Name != "(top level)" {
+				t.Errorf("stack doesn't end at the top level: %v", last.Name)
+			}
+		}
+	}
+	if calls != 7 {
+		t.Errorf("expected samples for 7 calls of fact, got %d", calls)
+	}
+}
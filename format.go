@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"monke/diagnostic"
+	"monke/printer"
+	"os"
+)
+
+// formats the given files, or stdin if there are none
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write the result back to the files instead of printing it")
+	list := flags.Bool("l", false, "list the files whose formatting differs")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: monke fmt [-w] [-l] [file ...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		source, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		formatted, ok := formatSource("<stdin>", string(source))
+		if !ok {
+			return 1
+		}
+		fmt.Print(formatted)
+		return 0
+	}
+
+	status := 0
+	for _, fileName := range flags.Args() {
+		source, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+
+		formatted, ok := formatSource(fileName, string(source))
+		if !ok {
+			status = 1
+			continue
+		}
+
+		changed := formatted != string(source)
+		if *list && changed {
+			fmt.Println(fileName)
+		}
+		if *write {
+			if changed {
+				if err := ioutil.WriteFile(fileName, []byte(formatted), 0644); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					status = 1
+				}
+			}
+		} else if !*list {
+			fmt.Print(formatted)
+		}
+	}
+
+	return status
+}
+
+// formats source, printing its syntax errors if it has any
+func formatSource(fileName, source string) (string, bool) {
+	formatted, err := printer.Format(source)
+	if perr, ok := err.(*printer.ParseError); ok {
+		for _, d := range perr.Diagnostics {
+			diagnostic.Render(os.Stderr, fileName, source, d)
+		}
+		return "", false
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return "", false
+	}
+	return formatted, true
+}
@@ -0,0 +1,18 @@
+// Package golden holds a corpus of Monke programs in testdata, each with the
+// results it is expected to have in golden files next to it, and the test
+// that runs them the way `monke run` does and checks the results:
+//
+//	name.ast    the program as the parser understood it
+//	name.out    what the program printed, and the values of the statements
+//	            at the top level
+//	name.err    the syntax errors, or the errors running the program reported
+//
+// Golden files for empty results are left out. After changing the language
+// on purpose, rewrite them with
+//
+//	go test ./golden -update
+//
+// and review the diff. Modules the programs import live in testdata/lib,
+// and the example programs at the root of the repository are checked too,
+// with their golden files in testdata/examples.
+package golden
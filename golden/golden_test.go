@@ -0,0 +1,184 @@
+package golden
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"monke/ast"
+	"monke/evaluator"
+	"monke/lexer"
+	"monke/parser"
+	"monke/repl"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the current results")
+
+// the extensions Monke programs have
+var EXTENSIONS = []string{".grr", ".brr", ".hoot", ".coo"}
+
+// results are what running a program led to, keyed by the extension of
+// their golden file
+type results map[string]string
+
+// backend runs programs that parse. Every backend has to get the results in
+// the golden files, which are written from the first one.
+type backend struct {
+	name string
+	run  func(t *testing.T, fileName string) results
+}
+
+var backends = []backend{
+	{"monke run", runFile},
+}
+
+// runs the program in fileName the way `monke run` does, which echoes the
+// value of every statement at the top level
+func runFile(t *testing.T, fileName string) results {
+	var out, errs bytes.Buffer
+	in := evaluator.New()
+	in.Stdin = strings.NewReader("")
+	in.Stderr = &errs
+
+	if err := repl.InterpretFileWith(in, fileName, &out); err != nil {
+		t.Fatal(err)
+	}
+	return results{".out": out.String(), ".err": errs.String()}
+}
+
+// a program of the corpus and where its golden files go
+type program struct {
+	file   string
+	golden string // the golden files without their extension
+}
+
+func corpus(t *testing.T) []program {
+	var programs []program
+	for _, ext := range EXTENSIONS {
+		files, err := filepath.Glob(filepath.Join("testdata", "*"+ext))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			programs = append(programs, program{file, strings.TrimSuffix(file, ext)})
+		}
+
+		examples, err := filepath.Glob(filepath.Join("..", "*"+ext))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range examples {
+			golden := filepath.Join("testdata", "examples", strings.TrimSuffix(filepath.Base(file), ext))
+			programs = append(programs, program{file, golden})
+		}
+	}
+	sort.Slice(programs, func(i, j int) bool { return programs[i].file < programs[j].file })
+	return programs
+}
+
+// parses the program in fileName, returning its syntax errors as results
+func parse(t *testing.T, fileName string) (*ast.Program, results) {
+	source, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if diagnostics := p.Diagnostics(); len(diagnostics) != 0 {
+		var errors strings.Builder
+		for _, d := range diagnostics {
+			fmt.Fprintf(&errors, "%d:%d: %s\n", d.Span.Start.Line, d.Span.Start.Column, d.Message)
+		}
+		return nil, results{".err": errors.String()}
+	}
+	return program, results{".ast": program.String() + "\n"}
+}
+
+func TestCorpus(t *testing.T) {
+	programs := corpus(t)
+	if len(programs) == 0 {
+		t.Fatal("no programs in testdata")
+	}
+
+	for _, p := range programs {
+		p := p
+		t.Run(p.file, func(t *testing.T) {
+			program, parsed := parse(t, p.file)
+
+			for i, b := range backends {
+				got := results{}
+				for ext, result := range parsed {
+					got[ext] = result
+				}
+				if program != nil {
+					for ext, result := range b.run(t, p.file) {
+						got[ext] = result
+					}
+				}
+
+				if *update && i == 0 {
+					writeGolden(t, p.golden, got)
+				}
+				checkGolden(t, b.name, p.golden, got)
+			}
+		})
+	}
+}
+
+var GOLDEN_EXTENSIONS = []string{".ast", ".out", ".err"}
+
+// writes the non-empty results and removes the golden files of empty ones
+func writeGolden(t *testing.T, golden string, got results) {
+	if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, ext := range GOLDEN_EXTENSIONS {
+		if got[ext] == "" {
+			if err := os.Remove(golden + ext); err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := ioutil.WriteFile(golden+ext, []byte(got[ext]), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkGolden(t *testing.T, name, golden string, got results) {
+	for _, ext := range GOLDEN_EXTENSIONS {
+		want, err := ioutil.ReadFile(golden + ext)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		if got[ext] != string(want) {
+			t.Errorf("%s: %s differs from %s%s (run with -update to accept)\n%s",
+				name, ext, golden, ext, diff(string(want), got[ext]))
+		}
+	}
+}
+
+// describes where got first differs from want, line by line
+func diff(want, got string) string {
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+	for i := 0; ; i++ {
+		if i >= len(wantLines) || i >= len(gotLines) || wantLines[i] != gotLines[i] {
+			return fmt.Sprintf("first difference on line %d:\n-%s\n+%s", i+1, line(wantLines, i), line(gotLines, i))
+		}
+	}
+}
+
+// the line at i, or a note that there isn't one
+func line(lines []string, i int) string {
+	if i >= len(lines) {
+		return " (end of output)"
+	}
+	return lines[i]
+}
@@ -0,0 +1,31 @@
+//go:build go1.18
+// +build go1.18
+
+package lexer
+
+import (
+	"monke/token"
+	"testing"
+)
+
+// Every token but EOF starts after the one before it and within the input.
+// The seeds are in testdata/fuzz/FuzzNextToken.
+func FuzzNextToken(f *testing.F) {
+	f.Fuzz(func(t *testing.T, input string) {
+		l := New(input)
+		offset := -1
+		// every token but EOF takes up at least one byte
+		for i := 0; i <= len(input); i++ {
+			tok := l.NextToken()
+			if tok.Type == token.EOF {
+				return
+			}
+			if tok.Pos.Offset <= offset || tok.Pos.Offset >= len(input) {
+				t.Fatalf("token %d %q is at offset %d, after %d in an input of %d bytes",
+					i, tok.Literal, tok.Pos.Offset, offset, len(input))
+			}
+			offset = tok.Pos.Offset
+		}
+		t.Fatalf("no EOF after %d tokens", len(input)+1)
+	})
+}
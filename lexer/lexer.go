@@ -1,6 +1,9 @@
 package lexer
 
-import "monke/token"
+import (
+	"monke/token"
+	"strings"
+)
 // Lexer struct contains the string it is lexing
 // the (current) 'position' it is at
 // the (next position) 'readPosition'
@@ -10,6 +13,11 @@ type Lexer struct {
     position int
     readPosition int
     ch byte
+    // line and column of 'ch', both starting at 1
+    line int
+    column int
+    // the comments skipped so far, in order
+    comments []token.Token
 }
 
 // helper function to skip all unnecessary white spaces
@@ -19,10 +27,34 @@ func (l* Lexer) skipWhitespace() {
     }
 }
 
+// skips a '//' comment up to the end of the line, remembering it for Comments
+func (l *Lexer) skipComment() {
+	tok := token.Token{Type: token.COMMENT, Pos: token.Position{Offset: l.position, Line: l.line, Column: l.column}}
+
+	position := l.position
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	tok.Literal = strings.TrimRight(l.input[position:l.position], " \t\r")
+
+	l.comments = append(l.comments, tok)
+}
+
+// reports whether 'ch' starts a '//' comment
+func (l *Lexer) atComment() bool {
+	return l.ch == '/' && l.readPosition < len(l.input) && l.input[l.readPosition] == '/'
+}
+
+// Comments returns the comments the lexer has skipped so far. They aren't
+// part of the token stream, but tools like the formatter need to keep them.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
 // returns the character at readPosition.
 // If readPosition is beyond EOF it returns 0 (ASCII for EOF)
 func (l* Lexer)peekChar() byte{
-	if l.readPosition > len(l.input){
+	if l.readPosition >= len(l.input){
 		return 0
 	} else {
 		return l.input[l.readPosition]
@@ -47,10 +79,14 @@ func (l* Lexer)readNumber() string {
 }
 
 // lexes the current 'ch' and creates new Tokens accordingly
-func (l *Lexer) NextToken() token.Token {
-    var tok token.Token
-
+func (l *Lexer) NextToken() (tok token.Token) {
     l.skipWhitespace()
+    for l.atComment() {
+        l.skipComment()
+        l.skipWhitespace()
+    }
+    pos := token.Position{Offset: l.position, Line: l.line, Column: l.column}
+    defer func() { tok.Pos = pos }()
 
     switch l.ch {
 	case '=':
@@ -90,6 +126,14 @@ func (l *Lexer) NextToken() token.Token {
 	case '>': tok = newToken(token.GT, l.ch)
 	case '{': tok = newToken(token.LBRACE, l.ch)
 	case '}': tok = newToken(token.RBRACE, l.ch)
+	case '.':
+		if strings.HasPrefix(l.input[l.position:], "...") {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case '"':
 		tok.Type = token.STRING
 		tok.Literal = l.readString()
@@ -148,6 +192,13 @@ func newToken(tokenType token.TokenType, ch byte) token.Token {
 
 // helper function to read the current character and advance readPosition and position
 func (l* Lexer) readChar(){
+	// keeps track of the line and column of the character we move to
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	// sets current character to character at position
     if l.readPosition >= len(l.input){
         l.ch = 0
@@ -162,7 +213,7 @@ func (l* Lexer) readChar(){
 
 // creates a new lexer and returns a pointer to it
 func New(input string) *Lexer{
-    l := &Lexer{input: input}
+    l := &Lexer{input: input, line: 1}
     l.readChar() //XXX: Why?
     return l
 }
@@ -1,6 +1,9 @@
 package lexer
 
 import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"monke/token"
@@ -30,6 +33,7 @@ if (5 < 10) {
 "foo bar"
 [1, 2];
 {"foo": "bar"}
+fn(...rest) ..
 `
 
 	tests := []struct {
@@ -122,6 +126,13 @@ if (5 < 10) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.RPAREN, ")"},
+		{token.ILLEGAL, "."},
+		{token.ILLEGAL, "."},
 		{token.EOF, ""},
 	}
 
@@ -141,3 +152,111 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x == \"a b\"\n"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedPos     token.Position
+	}{
+		{"let", token.Position{Offset: 0, Line: 1, Column: 1}},
+		{"x", token.Position{Offset: 4, Line: 1, Column: 5}},
+		{"=", token.Position{Offset: 6, Line: 1, Column: 7}},
+		{"5", token.Position{Offset: 8, Line: 1, Column: 9}},
+		{";", token.Position{Offset: 9, Line: 1, Column: 10}},
+		{"x", token.Position{Offset: 13, Line: 2, Column: 3}},
+		{"==", token.Position{Offset: 15, Line: 2, Column: 5}},
+		{"a b", token.Position{Offset: 18, Line: 2, Column: 8}},
+		{"", token.Position{Offset: 24, Line: 3, Column: 1}},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - position of %q wrong. expected=%+v, got=%+v",
+				i, tok.Literal, tt.expectedPos, tok.Pos)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "// header\nlet x = 10 / 2; // five\n//\nx"
+
+	expectedTokens := []string{"let", "x", "=", "10", "/", "2", ";", "x", ""}
+	expectedComments := []struct {
+		literal string
+		pos     token.Position
+	}{
+		{"// header", token.Position{Offset: 0, Line: 1, Column: 1}},
+		{"// five", token.Position{Offset: 26, Line: 2, Column: 17}},
+		{"//", token.Position{Offset: 34, Line: 3, Column: 1}},
+	}
+
+	l := New(input)
+
+	for i, expected := range expectedTokens {
+		tok := l.NextToken()
+		if tok.Literal != expected {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, expected, tok.Literal)
+		}
+	}
+
+	comments := l.Comments()
+	if len(comments) != len(expectedComments) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expectedComments), len(comments))
+	}
+
+	for i, tt := range expectedComments {
+		if comments[i].Type != token.COMMENT || comments[i].Literal != tt.literal || comments[i].Pos != tt.pos {
+			t.Errorf("comments[%d] wrong. expected=%q at %+v, got=%+v", i, tt.literal, tt.pos, comments[i])
+		}
+	}
+}
+
+// benchmarkProgram is one of the programs in testdata/bench at the root of
+// the repository
+type benchmarkProgram struct {
+	name   string
+	source string
+}
+
+func benchmarkPrograms(b *testing.B) []benchmarkProgram {
+	files, err := filepath.Glob(filepath.Join("..", "testdata", "bench", "*.grr"))
+	if err != nil || len(files) == 0 {
+		b.Fatalf("no benchmark programs: %v", err)
+	}
+
+	var programs []benchmarkProgram
+	for _, file := range files {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+		name := strings.TrimSuffix(filepath.Base(file), ".grr")
+		programs = append(programs, benchmarkProgram{name, string(source)})
+	}
+	return programs
+}
+
+func BenchmarkNextToken(b *testing.B) {
+	for _, program := range benchmarkPrograms(b) {
+		b.Run(program.name, func(b *testing.B) {
+			b.SetBytes(int64(len(program.source)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				l := New(program.source)
+				for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"monke/diagnostic"
+	"monke/evaluator"
+	"monke/lexer"
+	"monke/lint"
+	"monke/parser"
+	"os"
+	"strings"
+)
+
+// a lint diagnostic as it is written with -format json
+type lintProblem struct {
+	File        string   `json:"file"`
+	Line        int      `json:"line"`
+	Column      int      `json:"column"`
+	EndLine     int      `json:"endLine"`
+	EndColumn   int      `json:"endColumn"`
+	Severity    string   `json:"severity"`
+	Code        string   `json:"code"`
+	Rule        string   `json:"rule,omitempty"`
+	Message     string   `json:"message"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// lints the given files. It exits with 1 if it found anything.
+func runLint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	format := flags.String("format", "text", "output format, text or json")
+	enable := flags.String("enable", "", "comma separated rules to run instead of all of them")
+	disable := flags.String("disable", "", "comma separated rules not to run")
+	listRules := flags.Bool("rules", false, "list the rules and exit")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: monke lint [-format text|json] [-enable rules] [-disable rules] file ...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *listRules {
+		for _, rule := range lint.Rules {
+			fmt.Printf("%s %-22s %s\n", rule.Code, rule.Name, rule.Doc)
+		}
+		return 0
+	}
+
+	if (*format != "text" && *format != "json") || flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	rules, err := selectRules(*enable, *disable)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	config := lint.Config{Rules: rules, Builtins: map[string]int{}}
+	interpreter := evaluator.New()
+	for _, name := range interpreter.Builtins() {
+		builtin, _ := interpreter.Builtin(name)
+		config.Builtins[name] = builtin.Arity
+	}
+
+	status := 0
+	problems := []lintProblem{}
+	for _, fileName := range flags.Args() {
+		source, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+
+		p := parser.New(lexer.New(string(source)))
+		program := p.ParseProgram()
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) == 0 {
+			diagnostics = lint.Lint(program, config)
+		}
+
+		for _, d := range diagnostics {
+			status = 1
+			if *format == "json" {
+				problems = append(problems, newLintProblem(fileName, d))
+			} else {
+				fmt.Printf("%s:%s\n", fileName, d)
+			}
+		}
+	}
+
+	if *format == "json" {
+		out, _ := json.MarshalIndent(problems, "", "  ")
+		fmt.Println(string(out))
+	}
+	return status
+}
+
+// returns the rules to run given the -enable and -disable flags
+func selectRules(enable, disable string) ([]*lint.Rule, error) {
+	rules := lint.Rules
+	if enable != "" {
+		rules = nil
+		for _, name := range strings.Split(enable, ",") {
+			rule, ok := lint.RuleNamed(strings.TrimSpace(name))
+			if !ok {
+				return nil, fmt.Errorf("unknown rule %q, see monke lint -rules", name)
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	disabled := map[string]bool{}
+	if disable != "" {
+		for _, name := range strings.Split(disable, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := lint.RuleNamed(name); !ok {
+				return nil, fmt.Errorf("unknown rule %q, see monke lint -rules", name)
+			}
+			disabled[name] = true
+		}
+	}
+
+	selected := []*lint.Rule{}
+	for _, rule := range rules {
+		if !disabled[rule.Name] {
+			selected = append(selected, rule)
+		}
+	}
+	return selected, nil
+}
+
+func newLintProblem(fileName string, d diagnostic.Diagnostic) lintProblem {
+	problem := lintProblem{
+		File:        fileName,
+		Line:        d.Span.Start.Line,
+		Column:      d.Span.Start.Column,
+		EndLine:     d.Span.End.Line,
+		EndColumn:   d.Span.End.Column,
+		Severity:    d.Severity.String(),
+		Code:        d.Code,
+		Message:     d.Message,
+		Suggestions: d.Suggestions,
+	}
+	if rule, ok := lint.RuleFor(d.Code); ok {
+		problem.Rule = rule.Name
+	}
+	return problem
+}
@@ -0,0 +1,340 @@
+// Package lint finds code that runs but is probably wrong, like variables
+// that are never used or comparisons that always come out the same.
+package lint
+
+import (
+	"fmt"
+	"monke/ast"
+	"monke/diagnostic"
+	"monke/object"
+	"monke/resolver"
+	"monke/token"
+	"sort"
+	"strings"
+)
+
+// Rule is one kind of problem the linter looks for.
+type Rule struct {
+	Name  string // what the rule is called on the command line
+	Code  string // the code of the diagnostics it reports
+	Doc   string
+	check func(p *pass)
+}
+
+// Rules lists every rule, in the order of their codes.
+var Rules []*Rule
+
+func init() {
+	Rules = []*Rule{
+		{"unused-variable", "L001", "let bindings inside functions that are never used", checkUnused},
+		{"unreachable-code", "L002", "statements after a return or throw in the same block", checkUnreachable},
+		{"shadowed-builtin", "L003", "bindings that hide a builtin function", checkShadowedBuiltins},
+		{"wrong-argument-count", "L004", "calls with the wrong number of arguments to a known function", checkArgumentCounts},
+		{"constant-comparison", "L005", "comparisons whose result never changes", checkConstantComparisons},
+		{"undefined-variable", "L006", "names used where nothing binds them yet", checkUndefined},
+	}
+}
+
+// RuleNamed returns the rule called name.
+func RuleNamed(name string) (*Rule, bool) {
+	for _, rule := range Rules {
+		if rule.Name == name {
+			return rule, true
+		}
+	}
+	return nil, false
+}
+
+// RuleFor returns the rule that reports diagnostics with the given code.
+func RuleFor(code string) (*Rule, bool) {
+	for _, rule := range Rules {
+		if rule.Code == code {
+			return rule, true
+		}
+	}
+	return nil, false
+}
+
+// Config is what to check and what the program can assume is defined.
+type Config struct {
+	// the rules to run, all of them if nil
+	Rules []*Rule
+	// the builtins available to the program and how many arguments each
+	// takes, object.VARIADIC for any number
+	Builtins map[string]int
+}
+
+// pass is the state of linting one program
+type pass struct {
+	program  *ast.Program
+	config   Config
+	resolved *resolver.Result
+	bindings map[*ast.Identifier]*resolver.Binding
+
+	rule        *Rule
+	diagnostics []diagnostic.Diagnostic
+}
+
+// Lint checks program against the rules in config and returns what it
+// found, ordered by position.
+func Lint(program *ast.Program, config Config) []diagnostic.Diagnostic {
+	builtins := make([]string, 0, len(config.Builtins))
+	for name := range config.Builtins {
+		builtins = append(builtins, name)
+	}
+
+	p := &pass{
+		program:  program,
+		config:   config,
+		resolved: resolver.Resolve(program, builtins),
+		bindings: make(map[*ast.Identifier]*resolver.Binding),
+	}
+	for _, ref := range p.resolved.References {
+		p.bindings[ref.Ident] = ref.Binding
+	}
+
+	rules := config.Rules
+	if rules == nil {
+		rules = Rules
+	}
+	for _, rule := range rules {
+		p.rule = rule
+		rule.check(p)
+	}
+
+	sort.SliceStable(p.diagnostics, func(i, j int) bool {
+		return p.diagnostics[i].Span.Start.Offset < p.diagnostics[j].Span.Start.Offset
+	})
+	return p.diagnostics
+}
+
+func (p *pass) report(span diagnostic.Span, msg string, suggestions ...string) {
+	p.diagnostics = append(p.diagnostics, diagnostic.Diagnostic{
+		Severity:    diagnostic.WARNING,
+		Code:        p.rule.Code,
+		Message:     msg,
+		Span:        span,
+		Suggestions: suggestions,
+	})
+}
+
+func checkUnused(p *pass) {
+	for _, d := range p.resolved.Diagnostics {
+		if d.Code == resolver.UNUSED {
+			p.report(d.Span, d.Message, d.Suggestions...)
+		}
+	}
+}
+
+func checkUndefined(p *pass) {
+	for _, d := range p.resolved.Diagnostics {
+		if d.Code == resolver.UNRESOLVED {
+			p.report(d.Span, d.Message, d.Suggestions...)
+		}
+	}
+}
+
+func checkUnreachable(p *pass) {
+	check := func(stmts []ast.Statement) {
+		// function declarations are bound before the block runs, so they
+		// aren't unreachable wherever they are
+		var live []ast.Statement
+		for _, stmt := range stmts {
+			if _, ok := stmt.(*ast.FunctionDeclaration); !ok {
+				live = append(live, stmt)
+			}
+		}
+
+		for i, stmt := range live[:max(len(live)-1, 0)] {
+			switch stmt.(type) {
+			case *ast.ReturnStatement, *ast.ThrowStatement:
+				next := live[i+1]
+				p.report(diagnostic.SpanOf(firstToken(next)),
+					fmt.Sprintf("unreachable code after %s", stmt.TokenLiteral()))
+				return
+			}
+		}
+	}
+
+	ast.Inspect(p.program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Program:
+			check(n.Statements)
+		case *ast.BlockStatement:
+			check(n.Statements)
+		}
+		return true
+	})
+}
+
+func firstToken(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token
+	case *ast.ReturnStatement:
+		return stmt.Token
+	case *ast.ThrowStatement:
+		return stmt.Token
+	case *ast.FunctionDeclaration:
+		return stmt.Token
+	case *ast.ExpressionStatement:
+		return stmt.Token
+	}
+	return token.Token{}
+}
+
+func checkShadowedBuiltins(p *pass) {
+	for _, b := range p.resolved.Bindings {
+		if _, ok := p.config.Builtins[b.Name.Value]; ok {
+			p.report(diagnostic.SpanOf(b.Name.Token),
+				fmt.Sprintf("%s %s hides the builtin function %s", b.Kind, b.Name.Value, b.Name.Value),
+				"pick another name")
+		}
+	}
+}
+
+func checkArgumentCounts(p *pass) {
+	ast.Inspect(p.program, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpression)
+		if !ok {
+			return true
+		}
+
+		name, min, max := "", 0, object.VARIADIC
+		switch fn := call.Function.(type) {
+		case *ast.FunctionLiteral:
+			name = "function"
+			min, max = arity(fn)
+		case *ast.Identifier:
+			b := p.bindings[fn]
+			if b == nil {
+				if n, ok := p.config.Builtins[fn.Value]; ok {
+					name, min, max = fn.Value, n, n
+				}
+			} else if lit, ok := b.Value.(*ast.FunctionLiteral); ok {
+				name = fn.Value
+				min, max = arity(lit)
+			}
+		}
+
+		got := len(call.Arguments)
+		switch {
+		case name == "" || min == object.VARIADIC:
+		case got < min && max == object.VARIADIC:
+			p.report(diagnostic.SpanOf(call.Token),
+				fmt.Sprintf("%s takes at least %s, called with %d", name, plural(min, "argument"), got))
+		case got < min || (max != object.VARIADIC && got > max):
+			want := plural(max, "argument")
+			if min != max {
+				want = fmt.Sprintf("%d to %d arguments", min, max)
+			}
+			p.report(diagnostic.SpanOf(call.Token), fmt.Sprintf("%s takes %s, called with %d", name, want, got))
+		}
+		return true
+	})
+}
+
+// returns the fewest and most arguments fn can be called with, the most
+// being object.VARIADIC if it has a rest parameter
+func arity(fn *ast.FunctionLiteral) (int, int) {
+	min := len(fn.Parameters)
+	for min > 0 && fn.Default(min-1) != nil {
+		min--
+	}
+	if fn.Rest != nil {
+		return min, object.VARIADIC
+	}
+	return min, len(fn.Parameters)
+}
+
+func checkConstantComparisons(p *pass) {
+	ast.Inspect(p.program, func(n ast.Node) bool {
+		infix, ok := n.(*ast.InfixExpression)
+		if !ok {
+			return true
+		}
+
+		if result, ok := p.constantComparison(infix); ok {
+			p.report(diagnostic.SpanOf(infix.Token),
+				fmt.Sprintf("%s is always %t", infix.String(), result))
+		}
+		return true
+	})
+}
+
+// works out what a comparison between two literals, or of a variable with
+// itself, always evaluates to
+func (p *pass) constantComparison(infix *ast.InfixExpression) (bool, bool) {
+	switch infix.Operator {
+	case "==", "!=", "<", ">":
+	default:
+		return false, false
+	}
+
+	if l, ok := infix.Left.(*ast.Identifier); ok {
+		r, ok := infix.Right.(*ast.Identifier)
+		if !ok || l.Value != r.Value || p.bindings[l] != p.bindings[r] {
+			return false, false
+		}
+		return infix.Operator == "==", true
+	}
+
+	var cmp int
+	switch l := infix.Left.(type) {
+	case *ast.IntegerLiteral:
+		r, ok := infix.Right.(*ast.IntegerLiteral)
+		if !ok {
+			return false, false
+		}
+		cmp = compare(l.Value < r.Value, l.Value > r.Value)
+	case *ast.StringLiteral:
+		r, ok := infix.Right.(*ast.StringLiteral)
+		if !ok || (infix.Operator != "==" && infix.Operator != "!=") {
+			return false, false
+		}
+		cmp = strings.Compare(l.Value, r.Value)
+	case *ast.Boolean:
+		r, ok := infix.Right.(*ast.Boolean)
+		if !ok || (infix.Operator != "==" && infix.Operator != "!=") {
+			return false, false
+		}
+		cmp = compare(false, l.Value != r.Value)
+	default:
+		return false, false
+	}
+
+	switch infix.Operator {
+	case "==":
+		return cmp == 0, true
+	case "!=":
+		return cmp != 0, true
+	case "<":
+		return cmp < 0, true
+	default:
+		return cmp > 0, true
+	}
+}
+
+func compare(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,109 @@
+package lint
+
+import (
+	"monke/ast"
+	"monke/lexer"
+	"monke/object"
+	"monke/parser"
+	"testing"
+)
+
+var builtins = map[string]int{"len": 1, "puts": object.VARIADIC, "push": 2}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let f = fn(x) { x * 2 }; puts(f(len([1])))", nil},
+
+		// unused-variable
+		{"let f = fn() { let tmp = 1; 2 }; f()", []string{"1:20: warning[L001]: tmp is declared but never used"}},
+		{"let top = 1;", nil},
+
+		// unreachable-code
+		{"let f = fn() { return 1; puts(2); 3 }; f()", []string{"1:26: warning[L002]: unreachable code after return"}},
+		{"if (true) { throw \"x\"; let y = 1; y }", []string{"1:24: warning[L002]: unreachable code after throw"}},
+		{"let f = fn() { if (true) { return 1; } 2 }; f()", nil},
+		{"let f = fn() { return g(); fn g() { 1 } }; f()", nil},
+
+		// shadowed-builtin
+		{"let len = fn(x) { 0 }; len(1)", []string{"1:5: warning[L003]: let len hides the builtin function len"}},
+		{"let f = fn(puts) { puts }; f(1)", []string{"1:12: warning[L003]: parameter puts hides the builtin function puts"}},
+
+		// wrong-argument-count
+		{"let add = fn(a, b) { a + b }; add(1)", []string{"1:34: warning[L004]: add takes 2 arguments, called with 1"}},
+		{"len(1, 2)", []string{"1:4: warning[L004]: len takes 1 argument, called with 2"}},
+		{"puts(1, 2, 3)", nil},
+		{"fn(x) { x }()", []string{"1:12: warning[L004]: function takes 1 argument, called with 0"}},
+		{"let g = fn(f) { f(1, 2) }; g(len)", nil},
+		{"let f = fn(a, b = 1) { a + b }; f(1); f(1, 2)", nil},
+		{"let f = fn(a, b = 1) { a + b }; f()", []string{"1:34: warning[L004]: f takes 1 to 2 arguments, called with 0"}},
+		{"let f = fn(a, ...r) { a }; f(1, 2, 3)", nil},
+		{"f(1); fn f(a, b) { a }", []string{"1:2: warning[L004]: f takes 2 arguments, called with 1"}},
+		{"let f = fn(a, ...r) { a }; f()", []string{"1:29: warning[L004]: f takes at least 1 argument, called with 0"}},
+
+		// constant-comparison
+		{"if (1 < 2) { puts(1) }", []string{"1:7: warning[L005]: (1 < 2) is always true"}},
+		{"\"a\" == \"b\"", []string{"1:5: warning[L005]: (\"a\" == \"b\") is always false"}},
+		{"true != false", []string{"1:6: warning[L005]: (true != false) is always true"}},
+		{"let x = 1; x == x", []string{"1:14: warning[L005]: (x == x) is always true"}},
+		{"let x = 1; let y = 2; x == y", nil},
+		{"1 == true", nil},
+
+		// undefined-variable
+		{"puts(x); let x = 1;", []string{"1:6: warning[L006]: undefined: x"}},
+		{"let f = fn() { let y = z; let z = 1; y }; f()", []string{
+			"1:24: warning[L006]: undefined: z",
+			"1:31: warning[L001]: z is declared but never used",
+		}},
+		{"let f = fn() { g() }; let g = fn() { 1 }; f()", nil},
+	}
+
+	for _, tt := range tests {
+		diagnostics := Lint(parse(t, tt.input), Config{Builtins: builtins})
+
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("wrong number of diagnostics for %q. expected=%d, got=%d %v",
+				tt.input, len(tt.expected), len(diagnostics), diagnostics)
+			continue
+		}
+
+		for i, d := range diagnostics {
+			if d.String() != tt.expected[i] {
+				t.Errorf("wrong diagnostic for %q. expected=%q, got=%q", tt.input, tt.expected[i], d.String())
+			}
+		}
+	}
+}
+
+func TestConfigRules(t *testing.T) {
+	program := parse(t, "let len = fn() { let tmp = 1; return 2; 3 }; len(1 == 1)")
+
+	rule, ok := RuleNamed("unreachable-code")
+	if !ok {
+		t.Fatalf("no rule called unreachable-code")
+	}
+
+	diagnostics := Lint(program, Config{Rules: []*Rule{rule}, Builtins: builtins})
+	if len(diagnostics) != 1 || diagnostics[0].Code != rule.Code {
+		t.Errorf("expected only %s, got %v", rule.Code, diagnostics)
+	}
+
+	if all := Lint(program, Config{Builtins: builtins}); len(all) != 5 {
+		t.Errorf("expected every rule to report once, got %v", all)
+	}
+
+	if found, ok := RuleFor("L004"); !ok || found.Name != "wrong-argument-count" {
+		t.Errorf("RuleFor(L004) = %v", found)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"monke/lsp"
+	"os"
+)
+
+// serves the language server protocol over stdin and stdout
+func runLSP(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: monke lsp")
+		return 2
+	}
+
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,66 @@
+package lsp
+
+import (
+	"monke/ast"
+	"monke/diagnostic"
+	"monke/lexer"
+	"monke/parser"
+	"monke/resolver"
+	"strings"
+)
+
+// analysis is everything the server knows about one document
+type analysis struct {
+	program     *ast.Program
+	lines       []string
+	diagnostics []diagnostic.Diagnostic
+	*resolver.Result
+}
+
+func analyze(source string, builtins []string) *analysis {
+	p := parser.New(lexer.New(source))
+	a := &analysis{program: p.ParseProgram(), lines: strings.Split(source, "\n")}
+	a.Result = resolver.Resolve(a.program, builtins)
+
+	// names in statements the parser dropped can't be resolved, so only
+	// report on programs that parse
+	a.diagnostics = p.Diagnostics()
+	if len(a.diagnostics) == 0 {
+		a.diagnostics = a.Result.Diagnostics
+	}
+
+	return a
+}
+
+// guesses the type of a value from its syntax alone
+func staticType(value ast.Expression) string {
+	switch value := value.(type) {
+	case *ast.IntegerLiteral:
+		return "INTEGER"
+	case *ast.StringLiteral:
+		return "STRING"
+	case *ast.Boolean:
+		return "BOOLEAN"
+	case *ast.FunctionLiteral:
+		return "FUNCTION"
+	case *ast.ArrayLiteral:
+		return "ARRAY"
+	case *ast.HashLiteral, *ast.ImportExpression:
+		return "HASH"
+	case *ast.InfixExpression:
+		switch value.Operator {
+		case "<", ">", "==", "!=":
+			return "BOOLEAN"
+		}
+		left, right := staticType(value.Left), staticType(value.Right)
+		if left == right {
+			return left
+		}
+	case *ast.PrefixExpression:
+		if value.Operator == "!" {
+			return "BOOLEAN"
+		}
+		return "INTEGER"
+	}
+	return ""
+}
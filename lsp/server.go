@@ -0,0 +1,419 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"monke/ast"
+	"monke/diagnostic"
+	"monke/evaluator"
+	"monke/resolver"
+	"monke/token"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// Server answers LSP requests for .grr files. Documents are kept in memory
+// and re-analyzed every time they change.
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	documents map[string]*analysis
+	builtins  []string
+	shutdown  bool
+
+	// what the characters of positions count, agreed on in initialize
+	encoding string
+}
+
+// creates a new Server reading requests from in and writing to out
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: make(map[string]*analysis),
+		builtins:  evaluator.New().Builtins(),
+		encoding:  UTF16,
+	}
+}
+
+// Serve handles messages until the client sends exit or closes the stream.
+// It returns an error if the client exits without shutting down first.
+func (s *Server) Serve() error {
+	for {
+		msg, err := s.readMessage()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(msg, &req); err != nil {
+			s.replyError(nil, PARSE_ERROR, err.Error())
+			continue
+		}
+
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit without shutdown")
+			}
+			return nil
+		}
+
+		result, rpcErr := s.handle(req)
+		if req.ID == nil {
+			continue // notifications don't get a response
+		}
+		if rpcErr != nil {
+			s.replyError(req.ID, rpcErr.Code, rpcErr.Message)
+		} else {
+			s.write(response{JSONRPC: "2.0", ID: req.ID, Result: result})
+		}
+	}
+}
+
+func (s *Server) handle(req request) (interface{}, *responseError) {
+	switch req.Method {
+	case "initialize":
+		var params InitializeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		// our columns count bytes, so use them as they are if the client can
+		// take them, and count UTF-16 code units like every client must otherwise
+		s.encoding = UTF16
+		for _, encoding := range params.Capabilities.General.PositionEncodings {
+			if encoding == UTF8 {
+				s.encoding = UTF8
+			}
+		}
+
+		return InitializeResult{
+			Capabilities: ServerCapabilities{
+				PositionEncoding:       s.encoding,
+				TextDocumentSync:       TEXT_DOCUMENT_SYNC_FULL,
+				HoverProvider:          true,
+				DefinitionProvider:     true,
+				DocumentSymbolProvider: true,
+				CompletionProvider:     CompletionOptions{},
+			},
+			ServerInfo: ServerInfo{Name: "monke"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.update(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		// we only ask for full syncs, so the last change is the whole text
+		if n := len(params.ContentChanges); n > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(s.documents, params.TextDocument.URI)
+		s.publishDiagnostics(params.TextDocument.URI, nil)
+		return nil, nil
+
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.definition(params), nil
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.hover(params), nil
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.documentSymbols(params.TextDocument.URI), nil
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.completion(params), nil
+	}
+
+	if req.ID == nil {
+		return nil, nil // unknown notifications are ignored
+	}
+	return nil, &responseError{Code: METHOD_NOT_FOUND, Message: "method not found: " + req.Method}
+}
+
+func invalidParams(err error) *responseError {
+	return &responseError{Code: INVALID_PARAMS, Message: err.Error()}
+}
+
+// re-analyzes the document at uri and publishes its diagnostics
+func (s *Server) update(uri, text string) {
+	a := analyze(text, s.builtins)
+	s.documents[uri] = a
+	s.publishDiagnostics(uri, a)
+}
+
+// publishes the diagnostics of a, or clears them if a is nil
+func (s *Server) publishDiagnostics(uri string, a *analysis) {
+	params := PublishDiagnosticsParams{URI: uri, Diagnostics: []Diagnostic{}}
+
+	if a == nil {
+		a = &analysis{}
+	}
+	for _, d := range a.diagnostics {
+		message := d.Message
+		for _, suggestion := range d.Suggestions {
+			message += "\n" + suggestion
+		}
+
+		params.Diagnostics = append(params.Diagnostics, Diagnostic{
+			Range:    s.toRange(a, d.Span),
+			Severity: int(d.Severity) + 1, // LSP severities start at 1 for errors
+			Code:     d.Code,
+			Source:   "monke",
+			Message:  message,
+		})
+	}
+
+	s.write(notification{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics", Params: params})
+}
+
+func (s *Server) definition(params TextDocumentPositionParams) interface{} {
+	a, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+
+	ref, ok := a.ReferenceAt(s.fromPosition(a, params.Position))
+	if !ok || ref.Binding == nil {
+		return nil
+	}
+
+	return Location{
+		URI:   params.TextDocument.URI,
+		Range: s.toRange(a, diagnostic.SpanOf(ref.Binding.Name.Token)),
+	}
+}
+
+func (s *Server) hover(params TextDocumentPositionParams) interface{} {
+	a, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+
+	ref, ok := a.ReferenceAt(s.fromPosition(a, params.Position))
+	if !ok {
+		return nil
+	}
+
+	var contents string
+	switch {
+	case ref.Binding == nil && a.IsBuiltin(ref.Ident.Value):
+		contents = fmt.Sprintf("```monke\n%s\n```\nbuiltin function", ref.Ident.Value)
+	case ref.Binding == nil:
+		contents = fmt.Sprintf("`%s` is not defined", ref.Ident.Value)
+	case ref.Binding.Kind == resolver.LET_BINDING:
+		contents = fmt.Sprintf("```monke\nlet %s = %s\n```", ref.Ident.Value, ref.Binding.Value.String())
+		if typ := staticType(ref.Binding.Value); typ != "" {
+			contents += "\n" + typ
+		}
+	case ref.Binding.Kind == resolver.FUNC_BINDING:
+		fn := ref.Binding.Value.(*ast.FunctionLiteral)
+		contents = fmt.Sprintf("```monke\nfn %s(%s)\n```\nfunction", ref.Ident.Value,
+			ast.FormatParameters(fn.Parameters, fn.Defaults, fn.Rest))
+	default:
+		contents = fmt.Sprintf("```monke\n%s\n```\n%s", ref.Ident.Value, ref.Binding.Kind)
+	}
+
+	r := s.toRange(a, diagnostic.SpanOf(ref.Ident.Token))
+	return Hover{Contents: MarkupContent{Kind: "markdown", Value: contents}, Range: &r}
+}
+
+func (s *Server) documentSymbols(uri string) interface{} {
+	a, ok := s.documents[uri]
+	if !ok {
+		return nil
+	}
+	return s.declarationSymbols(a, a.program.Statements)
+}
+
+// lists the let statements and function declarations among stmts, with the
+// ones inside function bodies as their children
+func (s *Server) declarationSymbols(a *analysis, stmts []ast.Statement) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+
+	for _, stmt := range stmts {
+		if decl, ok := stmt.(*ast.FunctionDeclaration); ok {
+			fn := decl.Function
+			symbol := DocumentSymbol{
+				Name:           fn.Name.Value,
+				Kind:           SYMBOL_FUNCTION,
+				Detail:         "FUNCTION",
+				SelectionRange: s.toRange(a, diagnostic.SpanOf(fn.Name.Token)),
+				Children:       s.declarationSymbols(a, fn.Body.Statements),
+			}
+			symbol.Range = Range{Start: s.toPosition(a, decl.Token.Pos), End: symbol.SelectionRange.End}
+			symbols = append(symbols, symbol)
+			continue
+		}
+
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok {
+			continue
+		}
+
+		symbol := DocumentSymbol{
+			Name:           let.Name.Value,
+			Kind:           SYMBOL_VARIABLE,
+			Detail:         staticType(let.Value),
+			SelectionRange: s.toRange(a, diagnostic.SpanOf(let.Name.Token)),
+		}
+		symbol.Range = Range{Start: s.toPosition(a, let.Token.Pos), End: symbol.SelectionRange.End}
+
+		if fn, ok := let.Value.(*ast.FunctionLiteral); ok {
+			symbol.Kind = SYMBOL_FUNCTION
+			symbol.Children = s.declarationSymbols(a, fn.Body.Statements)
+		}
+
+		symbols = append(symbols, symbol)
+	}
+
+	return symbols
+}
+
+func (s *Server) completion(params TextDocumentPositionParams) interface{} {
+	items := []CompletionItem{}
+
+	for _, name := range s.builtins {
+		items = append(items, CompletionItem{Label: name, Kind: COMPLETION_FUNCTION, Detail: "builtin"})
+	}
+
+	for _, keyword := range []string{"fn", "let", "true", "false", "if", "else",
+		"return", "import", "try", "catch", "finally", "throw"} {
+		items = append(items, CompletionItem{Label: keyword, Kind: COMPLETION_KEYWORD})
+	}
+
+	if a, ok := s.documents[params.TextDocument.URI]; ok {
+		seen := map[string]bool{}
+		for _, b := range a.Bindings {
+			if seen[b.Name.Value] {
+				continue
+			}
+			seen[b.Name.Value] = true
+			items = append(items, CompletionItem{Label: b.Name.Value, Kind: COMPLETION_VARIABLE, Detail: b.Kind})
+		}
+	}
+
+	return items
+}
+
+// converts between our one based positions in a, whose columns count bytes,
+// and the zero based ones of LSP, whose characters count in s.encoding.
+// Columns past the end of their line, like the one after the last token,
+// are one character per byte.
+func (s *Server) toPosition(a *analysis, pos token.Position) Position {
+	character := pos.Column - 1
+	if s.encoding == UTF16 && pos.Line >= 1 && pos.Line <= len(a.lines) {
+		line := a.lines[pos.Line-1]
+		if character > len(line) {
+			character = utf16Len(line) + character - len(line)
+		} else {
+			character = utf16Len(line[:character])
+		}
+	}
+	return Position{Line: pos.Line - 1, Character: character}
+}
+
+func (s *Server) fromPosition(a *analysis, pos Position) token.Position {
+	column := pos.Character
+	if s.encoding == UTF16 && pos.Line >= 0 && pos.Line < len(a.lines) {
+		line := a.lines[pos.Line]
+		column = len(line) + pos.Character - utf16Len(line)
+		units := 0
+		for i, r := range line {
+			if units >= pos.Character {
+				column = i
+				break
+			}
+			units += utf16Units(r)
+		}
+	}
+	return token.Position{Line: pos.Line + 1, Column: column + 1}
+}
+
+func (s *Server) toRange(a *analysis, span diagnostic.Span) Range {
+	return Range{Start: s.toPosition(a, span.Start), End: s.toPosition(a, span.End)}
+}
+
+// counts the UTF-16 code units of text, with invalid bytes taking one each
+func utf16Len(text string) int {
+	units := 0
+	for _, r := range text {
+		units += utf16Units(r)
+	}
+	return units
+}
+
+func utf16Units(r rune) int {
+	if r > 0xFFFF {
+		return 2 // a surrogate pair
+	}
+	return 1
+}
+
+// reads one message framed by a Content-Length header
+func (s *Server) readMessage() ([]byte, error) {
+	headers, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(strings.TrimSpace(headers.Get("Content-Length")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %q", headers.Get("Content-Length"))
+	}
+
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(s.in, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (s *Server) write(msg interface{}) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, message string) {
+	s.write(response{JSONRPC: "2.0", ID: id, Error: &responseError{Code: code, Message: message}})
+}
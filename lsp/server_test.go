@@ -0,0 +1,290 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testURI = "file:///test.grr"
+
+// runs the server over the given requests and returns everything it sent
+// back, decoded
+func runServer(t *testing.T, requests ...string) []map[string]interface{} {
+	var in bytes.Buffer
+	for _, req := range requests {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(req), req)
+	}
+
+	var out bytes.Buffer
+	if err := NewServer(&in, &out).Serve(); err != nil {
+		t.Fatalf("Serve returned error: %s", err)
+	}
+
+	var messages []map[string]interface{}
+	s := &Server{in: bufio.NewReader(&out)}
+	for {
+		msg, err := s.readMessage()
+		if err != nil {
+			break
+		}
+		var decoded map[string]interface{}
+		if err := json.Unmarshal(msg, &decoded); err != nil {
+			t.Fatalf("server sent invalid JSON %q: %s", msg, err)
+		}
+		messages = append(messages, decoded)
+	}
+	return messages
+}
+
+func didOpen(text string) string {
+	params, _ := json.Marshal(DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: testURI, LanguageID: "monke", Text: text},
+	})
+	return fmt.Sprintf(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":%s}`, params)
+}
+
+func positionRequest(id int, method string, line, character int) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":%q,"params":{"textDocument":{"uri":%q},"position":{"line":%d,"character":%d}}}`,
+		id, method, testURI, line, character)
+}
+
+// finds the response to the request with the given id
+func responseTo(t *testing.T, messages []map[string]interface{}, id int) map[string]interface{} {
+	for _, msg := range messages {
+		if msgID, ok := msg["id"].(float64); ok && int(msgID) == id {
+			return msg
+		}
+	}
+	t.Fatalf("no response to request %d", id)
+	return nil
+}
+
+func TestInitialize(t *testing.T) {
+	messages := runServer(t, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+
+	result := responseTo(t, messages, 1)["result"].(map[string]interface{})
+	capabilities := result["capabilities"].(map[string]interface{})
+	for _, capability := range []string{"hoverProvider", "definitionProvider", "documentSymbolProvider"} {
+		if capabilities[capability] != true {
+			t.Errorf("capability %s not advertised", capability)
+		}
+	}
+}
+
+func TestPublishDiagnostics(t *testing.T) {
+	messages := runServer(t, didOpen("let x = 5;\nlet = 10;"))
+
+	if len(messages) != 1 || messages[0]["method"] != "textDocument/publishDiagnostics" {
+		t.Fatalf("expected one publishDiagnostics notification, got %v", messages)
+	}
+
+	params := messages[0]["params"].(map[string]interface{})
+	diagnostics := params["diagnostics"].([]interface{})
+	if len(diagnostics) == 0 {
+		t.Fatalf("no diagnostics published")
+	}
+
+	d := diagnostics[0].(map[string]interface{})
+	start := d["range"].(map[string]interface{})["start"].(map[string]interface{})
+	if start["line"] != 1.0 || start["character"] != 4.0 {
+		t.Errorf("diagnostic starts at %v, want line 1 character 4", start)
+	}
+	if d["severity"] != 1.0 {
+		t.Errorf("severity is %v, want 1", d["severity"])
+	}
+}
+
+func TestPublishResolverDiagnostics(t *testing.T) {
+	messages := runServer(t, didOpen("let f = fn() { puts(typo) };"))
+
+	params := messages[0]["params"].(map[string]interface{})
+	diagnostics := params["diagnostics"].([]interface{})
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %v", diagnostics)
+	}
+
+	d := diagnostics[0].(map[string]interface{})
+	if d["code"] != "R001" || d["message"] != "undefined: typo" {
+		t.Errorf("unexpected diagnostic %v", d)
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	source := "let add = fn(a, b) { a + b + two };\nlet two = 2;\nadd(1, 2);"
+
+	tests := []struct {
+		line, character int
+		expected        *Position
+	}{
+		{2, 1, &Position{0, 4}},   // add
+		{0, 30, &Position{1, 4}},  // two, bound after the function
+		{0, 21, &Position{0, 13}}, // a inside the function body
+		{2, 5, nil},               // not on an identifier
+	}
+
+	for i, tt := range tests {
+		messages := runServer(t, didOpen(source), positionRequest(1, "textDocument/definition", tt.line, tt.character))
+		result := responseTo(t, messages, 1)["result"]
+
+		if tt.expected == nil {
+			if result != nil {
+				t.Errorf("tests[%d]: expected no definition, got %v", i, result)
+			}
+			continue
+		}
+
+		location, ok := result.(map[string]interface{})
+		if !ok {
+			t.Errorf("tests[%d]: expected a location, got %v", i, result)
+			continue
+		}
+		start := location["range"].(map[string]interface{})["start"].(map[string]interface{})
+		if int(start["line"].(float64)) != tt.expected.Line || int(start["character"].(float64)) != tt.expected.Character {
+			t.Errorf("tests[%d]: definition at %v, want %v", i, start, *tt.expected)
+		}
+	}
+}
+
+func TestPositionEncoding(t *testing.T) {
+	// é is two bytes and one UTF-16 code unit, 😀 is four bytes and two units
+	source := "let s = \"é😀\"; puts(s, typo);"
+
+	tests := []struct {
+		encodings string
+		expected  string
+		// where s and typo start after the string
+		s, typo int
+	}{
+		{`[]`, UTF16, 20, 23},
+		{`["utf-16"]`, UTF16, 20, 23},
+		{`["utf-16", "utf-8"]`, UTF8, 23, 26},
+	}
+
+	for _, tt := range tests {
+		initialize := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"capabilities":{"general":{"positionEncodings":%s}}}}`,
+			tt.encodings)
+		messages := runServer(t, initialize, didOpen(source), positionRequest(2, "textDocument/definition", 0, tt.s))
+
+		capabilities := responseTo(t, messages, 1)["result"].(map[string]interface{})["capabilities"].(map[string]interface{})
+		if capabilities["positionEncoding"] != tt.expected {
+			t.Errorf("%s: position encoding is %v, want %s", tt.encodings, capabilities["positionEncoding"], tt.expected)
+		}
+
+		for _, msg := range messages {
+			if msg["method"] != "textDocument/publishDiagnostics" {
+				continue
+			}
+			d := msg["params"].(map[string]interface{})["diagnostics"].([]interface{})[0].(map[string]interface{})
+			r := d["range"].(map[string]interface{})
+			start, end := r["start"].(map[string]interface{}), r["end"].(map[string]interface{})
+			if start["character"] != float64(tt.typo) || end["character"] != float64(tt.typo+4) {
+				t.Errorf("%s: typo reported at %v-%v, want character %d", tt.encodings, start, end, tt.typo)
+			}
+		}
+
+		location, ok := responseTo(t, messages, 2)["result"].(map[string]interface{})
+		if !ok {
+			t.Errorf("%s: no definition for s", tt.encodings)
+			continue
+		}
+		start := location["range"].(map[string]interface{})["start"].(map[string]interface{})
+		if start["line"] != 0.0 || start["character"] != 4.0 {
+			t.Errorf("%s: definition at %v, want line 0 character 4", tt.encodings, start)
+		}
+	}
+}
+
+func TestHover(t *testing.T) {
+	source := "let x = 5 * 2;\nlet f = fn(y) { y + x };\nlen(\"\");\nfn g(a, b = 1) { a }"
+
+	tests := []struct {
+		line, character int
+		expected        []string
+	}{
+		{0, 4, []string{"let x = (5 * 2)", "INTEGER"}},
+		{1, 20, []string{"x", "INTEGER"}},
+		{1, 16, []string{"y", "parameter"}},
+		{2, 1, []string{"len", "builtin function"}},
+		{3, 3, []string{"fn g(a, b = 1)", "function"}},
+	}
+
+	for i, tt := range tests {
+		messages := runServer(t, didOpen(source), positionRequest(1, "textDocument/hover", tt.line, tt.character))
+		result, ok := responseTo(t, messages, 1)["result"].(map[string]interface{})
+		if !ok {
+			t.Errorf("tests[%d]: no hover", i)
+			continue
+		}
+
+		value := result["contents"].(map[string]interface{})["value"].(string)
+		for _, want := range tt.expected {
+			if !strings.Contains(value, want) {
+				t.Errorf("tests[%d]: hover %q doesn't contain %q", i, value, want)
+			}
+		}
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	source := "let x = 1;\nlet f = fn() { let inner = 2; inner };\nfn g() { 1 }"
+	request := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"textDocument/documentSymbol","params":{"textDocument":{"uri":%q}}}`, testURI)
+
+	messages := runServer(t, didOpen(source), request)
+	symbols := responseTo(t, messages, 1)["result"].([]interface{})
+
+	if len(symbols) != 3 {
+		t.Fatalf("expected 3 symbols, got %d", len(symbols))
+	}
+
+	f := symbols[1].(map[string]interface{})
+	if f["name"] != "f" || f["kind"] != float64(SYMBOL_FUNCTION) {
+		t.Errorf("unexpected symbol %v", f)
+	}
+	children, _ := f["children"].([]interface{})
+	if len(children) != 1 || children[0].(map[string]interface{})["name"] != "inner" {
+		t.Errorf("expected f to have child inner, got %v", children)
+	}
+
+	g := symbols[2].(map[string]interface{})
+	if g["name"] != "g" || g["kind"] != float64(SYMBOL_FUNCTION) {
+		t.Errorf("unexpected symbol %v", g)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	messages := runServer(t, didOpen("let counter = 0;"), positionRequest(1, "textDocument/completion", 0, 0))
+	items := responseTo(t, messages, 1)["result"].([]interface{})
+
+	labels := map[string]bool{}
+	for _, item := range items {
+		labels[item.(map[string]interface{})["label"].(string)] = true
+	}
+
+	for _, want := range []string{"len", "puts", "push", "let", "counter"} {
+		if !labels[want] {
+			t.Errorf("completion is missing %q", want)
+		}
+	}
+}
+
+func TestUnknownMethod(t *testing.T) {
+	messages := runServer(t, `{"jsonrpc":"2.0","id":7,"method":"textDocument/rename","params":{}}`)
+
+	rpcErr, ok := responseTo(t, messages, 7)["error"].(map[string]interface{})
+	if !ok || rpcErr["code"] != float64(METHOD_NOT_FOUND) {
+		t.Errorf("expected METHOD_NOT_FOUND, got %v", rpcErr)
+	}
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"exit"}`
+	in := strings.NewReader(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(req), req))
+
+	if err := NewServer(in, &bytes.Buffer{}).Serve(); err == nil {
+		t.Errorf("expected an error exiting without shutdown")
+	}
+}
@@ -8,12 +8,31 @@ import (
 	"path/filepath"
 )
 
+// subcommands are run as `monke <name> args...`. Anything else is treated as
+// a file to interpret.
+var subcommands = map[string]func(args []string) int{
+	"bench": runBench,
+	"dap":   runDAP,
+	"debug": runDebug,
+	"fmt":  runFmt,
+	"lint": runLint,
+	"lsp": runLSP,
+	"run": runRun,
+	"test": runTest,
+}
+
 func main(){
 	user, err := user.Current()
 	if err != nil{
 		panic(err)
 	}
 
+	if len(os.Args) >= 2 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
+
 	if len(os.Args) < 2 {
 
 	fmt.Printf("Hello %s! This is the Monke Programming language!\n", user.Username)
@@ -23,18 +42,14 @@ func main(){
 	} else {
 
 	fileName := os.Args[1]
-	file, err := os.Open(fileName)
 
-	if filepath.Ext(fileName) != ".grr" && filepath.Ext(fileName) != ".brr" && filepath.Ext(fileName) != ".hoot" && filepath.Ext(fileName) != "coo" {
+	if filepath.Ext(fileName) != ".grr" && filepath.Ext(fileName) != ".brr" && filepath.Ext(fileName) != ".hoot" && filepath.Ext(fileName) != ".coo" {
 			fmt.Println("Invalid file extension. Expected .grr | .brr | .coo | .hoot .")
 			return
 		}
 
-	if err != nil {
+	if err := repl.InterpretFile(fileName, os.Stdout); err != nil {
 		log.Fatal(err)
 	}
-
-	repl.Interpret(file, os.Stdout)
-	defer file.Close()
 	}
 }
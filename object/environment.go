@@ -1,35 +1,151 @@
 package object
 
-// import (
-// 	"fmt"
-// )
+import "sort"
+
+// the most bindings an environment keeps in a slice before it moves them to
+// a map
+const SMALL_ENV_SIZE = 8
 
 func NewEnvironment() *Environment {
-	s := make(map[string]Object)
-	return &Environment{store:s, outer: nil}
+	return &Environment{}
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
+	return &Environment{outer: outer}
+}
+
+// NewSizedEnclosedEnvironment is NewEnclosedEnvironment for an environment
+// that will hold about size bindings, such as a function's parameters, so
+// its bindings are allocated at the right size up front.
+func NewSizedEnclosedEnvironment(outer *Environment, size int) *Environment {
+	env := &Environment{outer: outer}
+	if size > SMALL_ENV_SIZE {
+		env.store = make(map[string]Object, size)
+	} else if size > 0 {
+		env.bindings = make([]binding, 0, size)
+	}
 	return env
 }
 
+// NewSlottedEnclosedEnvironment is NewEnclosedEnvironment for an environment
+// whose bindings the resolver gave slots, one for each of names.
+func NewSlottedEnclosedEnvironment(outer *Environment, names []string) *Environment {
+	bindings := make([]binding, len(names))
+	for i, name := range names {
+		bindings[i].name = name
+	}
+	return &Environment{bindings: bindings, slots: len(names), outer: outer}
+}
 
+// Environments keep their first few bindings in a slice, which is cheaper to
+// create and search than a map while it is small, like the environments of
+// most function calls. Past SMALL_ENV_SIZE they move to store.
+//
+// The environments of functions and catch blocks start with a binding for
+// each slot the resolver gave them, unbound until they are set, which
+// identifiers refer to by index. These stay in the slice however many
+// bindings there are.
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	bindings []binding
+	slots    int // how many of the bindings are slots
+	store    map[string]Object
+	outer    *Environment
+}
+
+type binding struct {
+	name  string
+	value Object
 }
 
-func (e *Environment) Get(name string) (Object, bool){
-	obj, ok := e.store[name]
-	if !ok && e.outer !=nil{
-		obj, ok = e.outer.Get(name)
+func (e *Environment) Get(name string) (Object, bool) {
+	for env := e; env != nil; env = env.outer {
+		if obj, ok := env.lookup(name); ok {
+			return obj, true
+		}
 	}
-	return obj, ok
+	return nil, false
+}
+
+// GetSlot returns the binding in slot index of the environment depth out
+// from e. It reports false if the slot is unbound or there is no such slot,
+// in which case the binding may still be found by name.
+func (e *Environment) GetSlot(depth, index int) (Object, bool) {
+	for ; depth > 0 && e != nil; depth-- {
+		e = e.outer
+	}
+	if e == nil || index >= e.slots || e.bindings[index].value == nil {
+		return nil, false
+	}
+	return e.bindings[index].value, true
+}
+
+// SetSlot binds val in slot index of e. It reports false if e has no such
+// slot, in which case nothing is bound.
+func (e *Environment) SetSlot(index int, val Object) bool {
+	if index >= e.slots {
+		return false
+	}
+	e.bindings[index].value = val
+	return true
+}
+
+// looks name up in e alone
+func (e *Environment) lookup(name string) (Object, bool) {
+	if e.store != nil {
+		obj, ok := e.store[name]
+		return obj, ok
+	}
+	for i := range e.bindings {
+		if e.bindings[i].name == name && e.bindings[i].value != nil {
+			return e.bindings[i].value, true
+		}
+	}
+	return nil, false
 }
 
 func (e *Environment) Set(name string, val Object) Object {
+	if e.store != nil {
+		e.store[name] = val
+		return val
+	}
+
+	for i := range e.bindings {
+		if e.bindings[i].name == name {
+			e.bindings[i].value = val
+			return val
+		}
+	}
+	if len(e.bindings) < SMALL_ENV_SIZE || e.slots > 0 {
+		e.bindings = append(e.bindings, binding{name, val})
+		return val
+	}
+
+	e.store = make(map[string]Object, 2*SMALL_ENV_SIZE)
+	for _, b := range e.bindings {
+		e.store[b.name] = b.value
+	}
+	e.bindings = nil
 	e.store[name] = val
 	return val
 }
+
+// Outer returns the environment e was enclosed in, or nil.
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// Names returns the names bound directly in e, ignoring outer environments,
+// in sorted order.
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.bindings)+len(e.store))
+	for _, b := range e.bindings {
+		if b.value != nil {
+			names = append(names, b.name)
+		}
+	}
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
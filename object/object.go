@@ -79,34 +79,55 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// Kinds of errors the interpreter raises, which catch clauses see as the
+// "type" of the error. RUNTIME_ERROR is for the errors of builtins the host
+// registers.
+const (
+	TYPE_ERROR       = "TypeError"           // operands or arguments of the wrong type
+	NAME_ERROR       = "NameError"           // identifiers that aren't bound
+	ARGUMENT_ERROR   = "ArgumentError"       // calls with the wrong number of arguments
+	DIVISION_ERROR   = "DivisionByZeroError" // integer division by zero
+	IMPORT_ERROR     = "ImportError"         // files that can't be imported
+	IO_ERROR         = "IOError"             // input that can't be read
+	STEP_LIMIT_ERROR = "StepLimitError"      // programs that ran out of steps
+	RUNTIME_ERROR    = "RuntimeError"
+)
+
+// Error aborts evaluation until it is caught or reaches the top level. Value
+// holds whatever a `throw` statement threw and is nil for errors raised by the
+// interpreter itself, which have one of the kinds above instead.
 type Error struct {
+	Kind    string
 	Message string
+	Value   Object
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
 type Function struct {
+	Name       string // empty for anonymous functions
+	File       string // the file the function was defined in, if any
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression // see ast.FunctionLiteral
+	Rest       *ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Locals     []string // see ast.FunctionLiteral
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
-	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
-	}
-
 	out.WriteString("fn")
+	if f.Name != "" {
+		out.WriteString(" " + f.Name)
+	}
 	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") {\n")
+	out.WriteString(ast.FormatParameters(f.Parameters, f.Defaults, f.Rest))
+	out.WriteString(") ")
 	out.WriteString(f.Body.String())
-	out.WriteString("\n}")
 
 	return out.String()
 }
@@ -124,8 +145,13 @@ func (s *String) HashKey() HashKey {
 	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
 
+// VARIADIC is the arity of builtins that take any number of arguments
+const VARIADIC = -1
+
 type Builtin struct {
-	Fn BuiltinFunction
+	Name  string
+	Arity int // how many arguments Fn takes, or VARIADIC
+	Fn    BuiltinFunction
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
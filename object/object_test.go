@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -58,3 +61,158 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("integers with twoerent content have same hash keys")
 	}
 }
+
+func TestEnvironment(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("shadowed", &String{Value: "outer"})
+	outer.Set("global", &String{Value: "global"})
+
+	// enough bindings for the environment to move them to a map
+	env := NewSizedEnclosedEnvironment(outer, 2)
+	var names []string
+	for i := 0; i < SMALL_ENV_SIZE+3; i++ {
+		name := fmt.Sprintf("v%02d", i)
+		names = append(names, name)
+		env.Set(name, &Integer{Value: int64(i)})
+
+		for j, name := range names {
+			if obj, ok := env.Get(name); !ok || obj.(*Integer).Value != int64(j) {
+				t.Fatalf("after %d bindings, %s is %v", i+1, name, obj)
+			}
+		}
+	}
+	env.Set("shadowed", &String{Value: "inner"})
+	env.Set("v00", &Integer{Value: 100})
+
+	tests := []struct {
+		env      *Environment
+		name     string
+		expected string
+	}{
+		{env, "shadowed", "inner"},
+		{outer, "shadowed", "outer"},
+		{env, "global", "global"},
+		{env, "v00", "100"},
+		{env, "v10", "10"},
+	}
+
+	for _, tt := range tests {
+		obj, ok := tt.env.Get(tt.name)
+		if !ok || obj.Inspect() != tt.expected {
+			t.Errorf("%s - want=%s, got=%v", tt.name, tt.expected, obj)
+		}
+	}
+	if _, ok := env.Get("missing"); ok {
+		t.Errorf("found a name that was never bound")
+	}
+
+	expected := append([]string{"shadowed"}, names...)
+	if got := env.Names(); fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("wrong names. want=%q, got=%q", expected, got)
+	}
+	if got := outer.Names(); fmt.Sprint(got) != fmt.Sprint([]string{"global", "shadowed"}) {
+		t.Errorf("wrong names in the outer environment: %q", got)
+	}
+}
+
+func TestSlottedEnvironment(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("x", &String{Value: "outer"})
+	env := NewSlottedEnclosedEnvironment(outer, []string{"x", "y"})
+
+	// an empty slot leaves the name to outer environments
+	if _, ok := env.GetSlot(0, 0); ok {
+		t.Errorf("empty slot reported as bound")
+	}
+	if obj, ok := env.Get("x"); !ok || obj.Inspect() != "outer" {
+		t.Errorf("x should come from the outer environment. got=%v", obj)
+	}
+
+	if !env.SetSlot(0, &String{Value: "slot"}) {
+		t.Fatalf("SetSlot(0) failed")
+	}
+	env.Set("y", &String{Value: "named"})
+	env.Set("z", &String{Value: "extra"})
+	if env.SetSlot(2, &String{Value: "none"}) {
+		t.Errorf("SetSlot(2) succeeded with only two slots")
+	}
+
+	tests := []struct {
+		depth, index int
+		expected     string
+	}{
+		{0, 0, "slot"},
+		{0, 1, "named"},
+		{0, 2, ""},
+		{1, 0, ""},
+		{2, 0, ""},
+	}
+
+	for _, tt := range tests {
+		obj, ok := env.GetSlot(tt.depth, tt.index)
+		if tt.expected == "" {
+			if ok {
+				t.Errorf("GetSlot(%d, %d) - expected nothing, got %v", tt.depth, tt.index, obj)
+			}
+			continue
+		}
+		if !ok || obj.Inspect() != tt.expected {
+			t.Errorf("GetSlot(%d, %d) - want=%s, got=%v", tt.depth, tt.index, tt.expected, obj)
+		}
+	}
+
+	if obj, ok := env.Get("x"); !ok || obj.Inspect() != "slot" {
+		t.Errorf("x should come from its slot. got=%v", obj)
+	}
+	if got := fmt.Sprint(env.Names()); got != "[x y z]" {
+		t.Errorf("wrong names. got=%s", got)
+	}
+}
+
+func BenchmarkEnvironmentGet(b *testing.B) {
+	// a lookup in the innermost scope, and one that walks out through every
+	// scope to the outermost
+	for _, depth := range []int{1, 10} {
+		outer := NewEnvironment()
+		outer.Set("global", &Integer{Value: 1})
+		env := outer
+		for i := 1; i < depth; i++ {
+			env = NewEnclosedEnvironment(env)
+		}
+		env.Set("local", &Integer{Value: 2})
+
+		for _, name := range []string{"local", "global"} {
+			b.Run(fmt.Sprintf("%s/depth=%d", name, depth), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, ok := env.Get(name); !ok {
+						b.Fatalf("%s not found", name)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkNewEnclosedEnvironment(b *testing.B) {
+	outer := NewEnvironment()
+	value := &Integer{Value: 1}
+
+	// the environment of a call to a function of two parameters
+	b.Run("sized", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			env := NewSizedEnclosedEnvironment(outer, 2)
+			env.Set("a", value)
+			env.Set("b", value)
+		}
+	})
+	b.Run("unsized", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			env := NewEnclosedEnvironment(outer)
+			env.Set("a", value)
+			env.Set("b", value)
+		}
+	})
+}
@@ -0,0 +1,31 @@
+//go:build go1.18
+// +build go1.18
+
+package parser
+
+import (
+	"monke/lexer"
+	"testing"
+)
+
+// Programs that parse have to print as source that parses to a program
+// that prints the same. The seeds are in testdata/fuzz/FuzzParseProgram.
+func FuzzParseProgram(f *testing.F) {
+	f.Fuzz(func(t *testing.T, input string) {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return
+		}
+
+		printed := program.String()
+		p = New(lexer.New(printed))
+		again := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("%q prints as %q, which doesn't parse: %q", input, printed, p.Errors())
+		}
+		if again.String() != printed {
+			t.Fatalf("%q prints as %q, which prints as %q", input, printed, again.String())
+		}
+	})
+}
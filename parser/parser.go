@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"monke/ast"
+	"monke/diagnostic"
 	"monke/lexer"
 	"monke/token"
 	"strconv"
@@ -43,9 +44,19 @@ var precedences = map[token.TokenType]int{
 // peekToken contains the nextToken in the program
 type Parser struct {
 	l *lexer.Lexer
-	errors []string
+	diagnostics []diagnostic.Diagnostic
 	currToken token.Token
 	peekToken token.Token
+	// pos counts the tokens consumed so far and depth is the brace nesting
+	// level of currToken. Both are used to resynchronize after an error.
+	pos int
+	depth int
+	// the errors already reported at each token position, to avoid reporting
+	// the same problem twice
+	reported map[int][]string
+	// failures counts every error found, including the ones not reported
+	// again, so a statement that fails where an earlier one did is dropped
+	failures int
 	// prefixParseFns and infixParseFns maps the type of token to the type of function
 	// that should be called when a particular token is encountered.
 	// Each token type can have up to two parsing functions associated with it
@@ -73,7 +84,7 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 // initializes currToken and peekToken
 func New(l *lexer.Lexer) *Parser{
 	// []string{} is an empty slice
-	p := &Parser{ l: l, errors: []string{} }
+	p := &Parser{ l: l, diagnostics: []diagnostic.Diagnostic{}, reported: make(map[int][]string) }
 	//Initializing currToken and peekToken
 	p.nextToken() // advances peekToken to the first token
 	p.nextToken() // advances currToken to the first token and peekToken to the second token
@@ -94,6 +105,8 @@ func New(l *lexer.Lexer) *Parser{
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.IMPORT, p.parseImportExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
@@ -136,6 +149,20 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	return hash
 }
 
+// import only accepts a string literal so the imported file is known
+// without evaluating anything
+func (p *Parser) parseImportExpression() ast.Expression {
+	exp := &ast.ImportExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+
+	exp.Path = &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Literal}
+
+	return exp
+}
+
 func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
 }
@@ -159,7 +186,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression{
 	value, err := strconv.ParseInt(p.currToken.Literal, 0, 64)
 	if(err!=nil){
 		msg := fmt.Sprintf("could not parse %q as integer", p.currToken.Literal)
-		p.errors = append (p.errors, msg)
+		p.addError(INVALID_INTEGER, p.currToken, msg)
 		return nil
 	}
 
@@ -255,6 +282,58 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		expression.CatchParam = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	if expression.Catch == nil && expression.Finally == nil {
+		msg := fmt.Sprintf("expected catch or finally after try block, got %s instead", p.peekToken.Type)
+		p.addError(INCOMPLETE_TRY, p.peekToken, msg, "add a `catch (e) { }` or `finally { }` block")
+		return nil
+	}
+
+	return expression
+}
+
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	lit := &ast.FunctionLiteral{ Token: p.currToken }
 
@@ -262,7 +341,9 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	if !p.parseFunctionParameters(lit) {
+		return nil
+	}
 
 	if !p.expectPeek(token.LBRACE){
 		return nil
@@ -273,32 +354,86 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+// parses fn name(params) { }, reusing the function literal parsing from the
+// name on
+func (p *Parser) parseFunctionDeclaration() ast.Statement {
+	tok := p.currToken
+	p.nextToken()
+	name := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	lit, ok := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+	if !ok {
+		return nil
+	}
+	lit.Token = tok
+	lit.Name = name
 
-	if p.peekTokenIs(token.RPAREN){
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
-		return identifiers
 	}
 
-	p.nextToken()
+	return &ast.FunctionDeclaration{Token: tok, Function: lit}
+}
 
-	ident := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
-	identifiers = append(identifiers, ident)
+// parses a parameter list into lit. Parameters with defaults have to come
+// after the ones without, and the rest parameter has to come last.
+func (p *Parser) parseFunctionParameters(lit *ast.FunctionLiteral) bool {
+	lit.Parameters = []*ast.Identifier{}
 
-	for (p.peekTokenIs(token.COMMA)){
-		p.nextToken()
+	if p.peekTokenIs(token.RPAREN){
 		p.nextToken()
+		return true
+	}
 
+	for {
+		if p.peekTokenIs(token.ELLIPSIS) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return false
+			}
+			lit.Rest = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+			if p.peekTokenIs(token.COMMA) {
+				p.addError(MISPLACED_PARAMETER, p.peekToken, "the rest parameter has to be the last one")
+				return false
+			}
+			break
+		}
+
+		if !p.expectPeek(token.IDENT) {
+			return false
+		}
 		ident := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
-		identifiers = append(identifiers, ident)
-	}
 
-	if !p.expectPeek(token.RPAREN){
-		return nil
+		var value ast.Expression
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			value = p.parseExpression(LOWEST)
+			if value == nil {
+				return false
+			}
+			if lit.Defaults == nil {
+				lit.Defaults = make([]ast.Expression, len(lit.Parameters))
+			}
+		} else if lit.Defaults != nil {
+			msg := fmt.Sprintf("parameter %s needs a default value since the ones before it have one", ident.Value)
+			p.addError(MISPLACED_PARAMETER, ident.Token, msg, fmt.Sprintf("give it one, like `%s = 0`", ident.Value))
+			return false
+		}
+
+		lit.Parameters = append(lit.Parameters, ident)
+		if lit.Defaults != nil {
+			lit.Defaults = append(lit.Defaults, value)
+		}
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
 	}
 
-	return identifiers
+	return p.expectPeek(token.RPAREN)
 }
 
 
@@ -311,48 +446,124 @@ func (p *Parser) parseCallExpression (function ast.Expression) ast.Expression{
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement {Token: p.currToken}
 	block.Statements = []ast.Statement{}
+	depth := p.depth
 
 	p.nextToken()
 
 	for !p.currTokenIs(token.RBRACE) && !p.currTokenIs(token.EOF) {
-		stmt := p.parseStatement()
-		if stmt != nil {
-			block.Statements = append(block.Statements, stmt)
+		stmt, ok := p.parseStatementOrSync()
+		if !ok {
+			// the failed statement ran past the '}' closing this block
+			if p.depth < depth {
+				break
+			}
+			continue
 		}
 
+		block.Statements = append(block.Statements, stmt)
 		p.nextToken()
 	}
 
 	return block
 }
 
+// Errors returns the messages of all diagnostics. Use Diagnostics for their
+// positions and codes.
 func (p *Parser) Errors() []string{
-	return p.errors
+	errors := []string{}
+	for _, d := range p.diagnostics {
+		errors = append(errors, d.Message)
+	}
+	return errors
+}
+
+// Diagnostics returns every problem found while parsing, in source order.
+func (p *Parser) Diagnostics() []diagnostic.Diagnostic {
+	return p.diagnostics
 }
 
 // advances peekToken and currToken by 1
 func (p *Parser) nextToken(){
+	if p.currTokenIs(token.RBRACE) {
+		p.depth--
+	}
+
 	p.currToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	p.pos++
+
+	if p.currTokenIs(token.LBRACE) {
+		p.depth++
+	}
 }
 
 // We create an empty ast.Program
 // We loop through the tokens in the given program
 // The meaningful statements are added to ~program~
 // To skip the semicolon and to jump to the next statement, we call p.nextToken()
+// Statements that fail to parse are left out, so the returned tree never
+// contains nil nodes even if there are errors.
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{Statements: []ast.Statement{}}
 
 	for !p.currTokenIs(token.EOF) {
-		stmt := p.parseStatement()
-		if stmt != nil {
-			program.Statements = append(program.Statements, stmt)
+		start := p.pos
+		stmt, ok := p.parseStatementOrSync()
+		if !ok {
+			// a stray '}' at the top level is the only place synchronizing
+			// can get stuck, skip over it
+			if p.pos == start {
+				p.nextToken()
+			}
+			continue
 		}
+
+		program.Statements = append(program.Statements, stmt)
 		p.nextToken()
 	}
 	return program
 }
 
+// parses a statement. If that runs into any errors, the statement is dropped
+// and the parser skips ahead to where the next statement starts, so one
+// mistake doesn't turn into a cascade of confusing errors.
+func (p *Parser) parseStatementOrSync() (ast.Statement, bool) {
+	start, depth, failures := p.pos, p.depth, p.failures
+
+	stmt := p.parseStatement()
+	if p.failures == failures {
+		return stmt, true
+	}
+
+	p.synchronize(start, depth)
+	return nil, false
+}
+
+// skips tokens until just after a ';', or up to a statement keyword or the
+// '}' closing the enclosing block. Only tokens at the brace depth the failed
+// statement started at count, so the ones inside nested blocks are skipped.
+// If the failed statement already consumed the closing '}', there is nothing
+// left to skip.
+func (p *Parser) synchronize(start, depth int) {
+	for !p.currTokenIs(token.EOF) && p.depth >= depth {
+		if p.depth == depth {
+			switch p.currToken.Type {
+			case token.SEMICOLON:
+				p.nextToken()
+				return
+			case token.RBRACE:
+				return
+			case token.LET, token.RETURN, token.THROW:
+				if p.pos > start {
+					return
+				}
+			}
+		}
+
+		p.nextToken()
+	}
+}
+
 // On the basis of the starting token it is chosen what kind of a statement we have,
 // and the necessary parsing for it
 func (p *Parser) parseStatement() ast.Statement {
@@ -361,6 +572,14 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.FUNCTION:
+		// without a name it's a function literal starting an expression
+		if p.peekTokenIs(token.IDENT) {
+			return p.parseFunctionDeclaration()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -406,6 +625,19 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement{
 	return stmt
 }
 
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.currToken}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	defer untrace(trace("parseExpressionStatement"))
 	stmt := &ast.ExpressionStatement{Token: p.currToken}
@@ -503,30 +735,86 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	}
 }
 
-func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
+// Precedence returns how tightly an operator of the given token type binds,
+// or LOWEST for tokens that aren't operators
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
 		return p
 	}
 
 	return LOWEST
 }
 
+func (p *Parser) peekPrecedence() int {
+	return Precedence(p.peekToken.Type)
+}
+
 func (p *Parser) currPrecedence() int {
-	if p, ok := precedences[p.currToken.Type]; ok {
-		return p
+	return Precedence(p.currToken.Type)
+}
+
+// Diagnostic codes reported by the parser
+const (
+	UNEXPECTED_TOKEN = "P001"
+	NO_PREFIX_PARSE_FN = "P002"
+	INVALID_INTEGER = "P003"
+	INCOMPLETE_TRY = "P004"
+	MISPLACED_PARAMETER = "P005"
+)
+
+// records an error unless the same one was already reported at the current
+// token
+func (p *Parser) addError(code string, tok token.Token, msg string, suggestions ...string) {
+	p.failures++
+	for _, reported := range p.reported[p.pos] {
+		if reported == msg {
+			return
+		}
 	}
 
-	return LOWEST
+	p.reported[p.pos] = append(p.reported[p.pos], msg)
+	p.diagnostics = append(p.diagnostics, diagnostic.Diagnostic{
+		Severity: diagnostic.ERROR,
+		Code: code,
+		Message: msg,
+		Span: diagnostic.SpanOf(tok),
+		Suggestions: suggestions,
+	})
+}
+
+// the tokens that are most likely just missing when we expect them but find
+// something else
+var closingTokens = map[token.TokenType]bool{
+	token.RPAREN: true,
+	token.RBRACE: true,
+	token.RBRACKET: true,
+	token.COLON: true,
+	token.COMMA: true,
+	token.ASSIGN: true,
 }
 
 // Error function
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+
+	suggestions := []string{}
+	if p.peekTokenIs(token.ASSIGN) && t != token.ASSIGN {
+		suggestions = append(suggestions, "did you mean `==`?")
+	} else if closingTokens[t] {
+		suggestions = append(suggestions, fmt.Sprintf("did you mean `%s`?", t))
+	}
+
+	p.addError(UNEXPECTED_TOKEN, p.peekToken, msg, suggestions...)
 }
 
 // Error handling for prefix expressions
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t);
-	p.errors = append(p.errors, msg);
+
+	suggestions := []string{}
+	if t == token.ASSIGN {
+		suggestions = append(suggestions, "did you mean `==`?")
+	}
+
+	p.addError(NO_PREFIX_PARSE_FN, p.currToken, msg, suggestions...);
 }
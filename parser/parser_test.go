@@ -2,8 +2,17 @@ package parser
 
 import (
 	"fmt"
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"io/ioutil"
 	"monke/ast"
 	"monke/lexer"
+	"monke/token"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -275,7 +284,7 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		},
 		{
 			"3 + 4; -5 * 5",
-			"(3 + 4)((-5) * 5)",
+			"(3 + 4);((-5) * 5)",
 		},
 		{
 			"5 > 4 == 3 < 4",
@@ -586,6 +595,84 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestDefaultAndRestParameterParsing(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedParams   []string
+		expectedDefaults []string
+		expectedRest     string
+	}{
+		{"fn(x, y = 10) {}", []string{"x", "y"}, []string{"", "10"}, ""},
+		{"fn(x = 1, y = x * 2) {}", []string{"x", "y"}, []string{"1", "(x * 2)"}, ""},
+		{"fn(...args) {}", []string{}, nil, "args"},
+		{"fn(first, ...rest) {}", []string{"first"}, nil, "rest"},
+		{"fn(a, b = [1], ...c) {}", []string{"a", "b"}, []string{"", "[1]"}, "c"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("%q: wrong number of parameters. want=%d, got=%d",
+				tt.input, len(tt.expectedParams), len(function.Parameters))
+		}
+		for i, name := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], name)
+		}
+
+		for i, expected := range tt.expectedDefaults {
+			actual := ""
+			if d := function.Default(i); d != nil {
+				actual = d.String()
+			}
+			if actual != expected {
+				t.Errorf("%q: wrong default for %s. want=%q, got=%q", tt.input, tt.expectedParams[i], expected, actual)
+			}
+		}
+		if tt.expectedDefaults == nil && function.Defaults != nil {
+			t.Errorf("%q: expected no defaults, got %v", tt.input, function.Defaults)
+		}
+
+		actualRest := ""
+		if function.Rest != nil {
+			actualRest = function.Rest.Value
+		}
+		if actualRest != tt.expectedRest {
+			t.Errorf("%q: wrong rest parameter. want=%q, got=%q", tt.input, tt.expectedRest, actualRest)
+		}
+	}
+}
+
+func TestMisplacedParameters(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"fn(x = 1, y) {}", "parameter y needs a default value since the ones before it have one"},
+		{"fn(...rest, x) {}", "the rest parameter has to be the last one"},
+		{"fn(1) {}", "expected next token to be IDENT, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) == 0 {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if diagnostics[0].Message != tt.expectedMessage {
+			t.Errorf("%q: wrong message. want=%q, got=%q", tt.input, tt.expectedMessage, diagnostics[0].Message)
+		}
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -812,7 +899,7 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 			continue
 		}
 
-		expectedValue := expected[literal.String()]
+		expectedValue := expected[literal.Value]
 		testIntegerLiteral(t, value, expectedValue)
 	}
 }
@@ -926,9 +1013,9 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 			continue
 		}
 
-		testFunc, ok := tests[literal.String()]
+		testFunc, ok := tests[literal.Value]
 		if !ok {
-			t.Errorf("No test function for key %q found", literal.String())
+			t.Errorf("No test function for key %q found", literal.Value)
 			continue
 		}
 
@@ -936,6 +1023,423 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 	}
 }
 
+func TestImportExpressionParsing(t *testing.T) {
+	input := `let lib = import "lib/util.grr";`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.LetStatement)
+	imp, ok := stmt.Value.(*ast.ImportExpression)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.ImportExpression. got=%T", stmt.Value)
+	}
+
+	if imp.Path.Value != "lib/util.grr" {
+		t.Errorf("imp.Path.Value not %q. got=%q", "lib/util.grr", imp.Path.Value)
+	}
+}
+
+func TestTryExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input      string
+		hasCatch   bool
+		hasFinally bool
+	}{
+		{`try { x } catch (e) { y }`, true, false},
+		{`try { x } finally { z }`, false, true},
+		{`try { x } catch (e) { y } finally { z }`, true, true},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.TryExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.TryExpression. got=%T", stmt.Expression)
+		}
+
+		if !testIdentifier(t, exp.Block.Statements[0].(*ast.ExpressionStatement).Expression, "x") {
+			return
+		}
+
+		if (exp.Catch != nil) != tt.hasCatch {
+			t.Errorf("exp.Catch wrong for %q. got=%+v", tt.input, exp.Catch)
+		}
+		if tt.hasCatch && !testIdentifier(t, exp.CatchParam, "e") {
+			return
+		}
+
+		if (exp.Finally != nil) != tt.hasFinally {
+			t.Errorf("exp.Finally wrong for %q. got=%+v", tt.input, exp.Finally)
+		}
+	}
+}
+
+func TestTryWithoutHandlers(t *testing.T) {
+	l := lexer.New(`try { x }`)
+	p := New(l)
+	p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected parser error for try without catch or finally")
+	}
+}
+
+func TestThrowStatements(t *testing.T) {
+	l := lexer.New(`throw "boom";`)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ThrowStatement. got=%T", program.Statements[0])
+	}
+	if stmt.String() != `throw "boom";` {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedProgram string
+		expectedErrors  int
+	}{
+		{"let x 5; let y = 10; y", "let y = 10;y", 1},
+		{"let f = fn(a, b { a + b }; let g = 1; g", "let g = 1;g", 1},
+		{"if (x { 1 } else { 2 }; let z = 3;", "let z = 3;", 1},
+		{"let a = ; let b = 2", "let b = 2;", 1},
+		{"} let c = 1;", "let c = 1;", 1},
+		{"fn(x) { let = 1; x + } ; 7", "7", 2},
+		{"let h = {1: 2, 3 4}; h", "h", 1},
+		{"add(1, 2; let q = 5", "let q = 5;", 1},
+		{"let x = let y = 5;", "let y = 5;", 1},
+		{"let a = 1 +; let b = 1 +; a", "a", 2},
+		{"if (x) { if (y) { let = 1 } 2 } let z = 3; z", "let z = 3;z", 1},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		if program.String() != tt.expectedProgram {
+			t.Errorf("wrong program for %q. expected=%q, got=%q",
+				tt.input, tt.expectedProgram, program.String())
+		}
+
+		if len(p.Errors()) != tt.expectedErrors {
+			t.Errorf("wrong number of errors for %q. expected=%d, got=%d %q",
+				tt.input, tt.expectedErrors, len(p.Errors()), p.Errors())
+		}
+
+		testNoNilNodes(t, reflect.ValueOf(program), "program")
+	}
+}
+
+// statements that fail to parse are dropped however the parser gets there,
+// even when it fails again at a token it already reported an error at
+func TestErrorRecoveryLeavesNoNilNodes(t *testing.T) {
+	inputs := []string{
+		"!}",
+		"-}",
+		"!}!}",
+		"1 + }",
+		"let x = !};",
+		"let x = !} let y = 2;",
+		"fn() { !} }",
+		"if (x) { !}",
+		"if (x) { 1 } else { -} }",
+		"[1, }",
+		"{1: }",
+		"a[}",
+		"f(}",
+		"try {",
+		"try { 1 } catch (e) { !} }",
+		"throw }",
+		"return !}",
+		"fn f(a = ) {}",
+		"fn(a, b",
+		"let = ; }",
+		"}}}",
+		"!",
+		"let",
+	}
+
+	for _, input := range inputs {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected errors for %q", input)
+		}
+		testNoNilNodes(t, reflect.ValueOf(program), fmt.Sprintf("%q", input))
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedCode       string
+		expectedLine       int
+		expectedColumn     int
+		expectedSuggestion string
+	}{
+		{"let x = 1;\nlet f = fn(a, b { a };", UNEXPECTED_TOKEN, 2, 17, "did you mean `)`?"},
+		{"if (x = 1) { 2 }", UNEXPECTED_TOKEN, 1, 7, "did you mean `==`?"},
+		{"let y = * 2;", NO_PREFIX_PARSE_FN, 1, 9, ""},
+		{"99999999999999999999", INVALID_INTEGER, 1, 1, ""},
+		{"try { 1 }", INCOMPLETE_TRY, 1, 10, "add a `catch (e) { }` or `finally { }` block"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Diagnostics()) != 1 {
+			t.Fatalf("expected 1 diagnostic for %q. got=%v", tt.input, p.Diagnostics())
+		}
+
+		d := p.Diagnostics()[0]
+		if d.Code != tt.expectedCode {
+			t.Errorf("wrong code for %q. expected=%s, got=%s", tt.input, tt.expectedCode, d.Code)
+		}
+		if d.Span.Start.Line != tt.expectedLine || d.Span.Start.Column != tt.expectedColumn {
+			t.Errorf("wrong position for %q. expected=%d:%d, got=%d:%d", tt.input,
+				tt.expectedLine, tt.expectedColumn, d.Span.Start.Line, d.Span.Start.Column)
+		}
+
+		if tt.expectedSuggestion == "" {
+			if len(d.Suggestions) != 0 {
+				t.Errorf("unexpected suggestions for %q. got=%q", tt.input, d.Suggestions)
+			}
+		} else if len(d.Suggestions) != 1 || d.Suggestions[0] != tt.expectedSuggestion {
+			t.Errorf("wrong suggestions for %q. expected=%q, got=%q",
+				tt.input, tt.expectedSuggestion, d.Suggestions)
+		}
+
+		if p.Errors()[0] != d.Message {
+			t.Errorf("Errors() does not match Diagnostics(). got=%q", p.Errors())
+		}
+	}
+}
+
+func TestFunctionDeclarations(t *testing.T) {
+	l := lexer.New("fn add(a, b = 1) { a + b }; fn(x) { x }")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program has wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	decl, ok := program.Statements[0].(*ast.FunctionDeclaration)
+	if !ok {
+		t.Fatalf("stmt not *ast.FunctionDeclaration. got=%T", program.Statements[0])
+	}
+	if decl.Function.Name == nil || decl.Function.Name.Value != "add" {
+		t.Errorf("function name wrong. got=%v", decl.Function.Name)
+	}
+	if len(decl.Function.Parameters) != 2 {
+		t.Errorf("function has wrong number of parameters. got=%d", len(decl.Function.Parameters))
+	}
+	if decl.String() != "fn add(a, b = 1) { (a + b) }" {
+		t.Errorf("decl.String() wrong. got=%q", decl.String())
+	}
+
+	// without a name, fn still starts an expression
+	stmt, ok := program.Statements[1].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ExpressionStatement. got=%T", program.Statements[1])
+	}
+	if fn, ok := stmt.Expression.(*ast.FunctionLiteral); !ok || fn.Name != nil {
+		t.Errorf("expected an anonymous function literal. got=%T", stmt.Expression)
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	tests := []struct {
+		tokenType token.TokenType
+		expected  int
+	}{
+		{token.EQ, EQUALS},
+		{token.NOT_EQ, EQUALS},
+		{token.LT, LESSGREATER},
+		{token.PLUS, SUM},
+		{token.ASTERISK, PRODUCT},
+		{token.LPAREN, CALL},
+		{token.LBRACKET, INDEX},
+		{token.IDENT, LOWEST},
+		{token.SEMICOLON, LOWEST},
+	}
+
+	for _, tt := range tests {
+		if got := Precedence(tt.tokenType); got != tt.expected {
+			t.Errorf("Precedence(%q) wrong. expected=%d, got=%d", tt.tokenType, tt.expected, got)
+		}
+	}
+}
+
+// Every program in this file should survive being printed with String and
+// parsed again: the new tree must be the same as the old one, and print the
+// same way.
+func TestStringRoundTrip(t *testing.T) {
+	fset := gotoken.NewFileSet()
+	file, err := goparser.ParseFile(fset, "parser_test.go", nil, 0)
+	if err != nil {
+		t.Fatalf("could not read the corpus: %s", err)
+	}
+
+	// every string literal in this file that parses cleanly is a program,
+	// except for the operators the prefix and infix tables expect
+	operators := map[string]bool{"!": true, "-": true, "+": true, "*": true, "/": true,
+		"<": true, ">": true, "==": true, "!=": true}
+	var corpus []string
+	goast.Inspect(file, func(n goast.Node) bool {
+		lit, ok := n.(*goast.BasicLit)
+		if !ok || lit.Kind != gotoken.STRING {
+			return true
+		}
+		input, err := strconv.Unquote(lit.Value)
+		if err != nil || input == "" || operators[input] {
+			return true
+		}
+		p := New(lexer.New(input))
+		if program := p.ParseProgram(); len(p.Errors()) == 0 && len(program.Statements) > 0 {
+			corpus = append(corpus, input)
+		}
+		return true
+	})
+
+	if len(corpus) < 50 {
+		t.Fatalf("corpus is suspiciously small: %d programs", len(corpus))
+	}
+
+	for _, input := range corpus {
+		original := New(lexer.New(input)).ParseProgram()
+		printed := original.String()
+
+		p := New(lexer.New(printed))
+		reparsed := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Errorf("String of %q doesn't parse: %q\n%v", input, printed, p.Errors())
+			continue
+		}
+
+		testSameTree(t, reflect.ValueOf(original), reflect.ValueOf(reparsed), fmt.Sprintf("%q", input))
+
+		if reprinted := reparsed.String(); reprinted != printed {
+			t.Errorf("String of %q isn't stable. first=%q, second=%q", input, printed, reprinted)
+		}
+	}
+}
+
+// compares two syntax trees, ignoring tokens since positions and grouping
+// parentheses are allowed to differ
+func testSameTree(t *testing.T, a, b reflect.Value, path string) {
+	if a.Kind() != b.Kind() {
+		t.Errorf("%s: %s vs %s", path, a.Kind(), b.Kind())
+		return
+	}
+
+	switch a.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				t.Errorf("%s: only one side is nil", path)
+			}
+			return
+		}
+		if a.Elem().Type() != b.Elem().Type() {
+			t.Errorf("%s: %s vs %s", path, a.Elem().Type(), b.Elem().Type())
+			return
+		}
+		testSameTree(t, a.Elem(), b.Elem(), path)
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			if field.Type == reflect.TypeOf(token.Token{}) {
+				continue
+			}
+			testSameTree(t, a.Field(i), b.Field(i), path+"."+field.Name)
+		}
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			t.Errorf("%s: %d vs %d elements", path, a.Len(), b.Len())
+			return
+		}
+		for i := 0; i < a.Len(); i++ {
+			testSameTree(t, a.Index(i), b.Index(i), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.Map:
+		// hash literal keys are pointers, so match them up by how they print
+		if a.Len() != b.Len() {
+			t.Errorf("%s: %d vs %d pairs", path, a.Len(), b.Len())
+			return
+		}
+		keys := map[string]reflect.Value{}
+		for _, key := range b.MapKeys() {
+			keys[key.Interface().(ast.Node).String()] = key
+		}
+		for _, key := range a.MapKeys() {
+			name := key.Interface().(ast.Node).String()
+			other, ok := keys[name]
+			if !ok {
+				t.Errorf("%s: key %s missing", path, name)
+				continue
+			}
+			testSameTree(t, key, other, path+"{"+name+"}")
+			testSameTree(t, a.MapIndex(key), b.MapIndex(other), path+"["+name+"]")
+		}
+	default:
+		if a.Interface() != b.Interface() {
+			t.Errorf("%s: %v vs %v", path, a.Interface(), b.Interface())
+		}
+	}
+}
+
+// walks the tree and fails for every nil node, statement or expression in it
+func testNoNilNodes(t *testing.T, v reflect.Value, path string) {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			t.Errorf("nil node at %s", path)
+			return
+		}
+		testNoNilNodes(t, v.Elem(), path)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.Type.Kind() == reflect.Ptr && v.Field(i).IsNil() &&
+				(field.Name == "Alternative" || field.Name == "Catch" ||
+					field.Name == "CatchParam" || field.Name == "Finally" ||
+					field.Name == "Slot") {
+				continue
+			}
+			testNoNilNodes(t, v.Field(i), path+"."+field.Name)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			testNoNilNodes(t, v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			testNoNilNodes(t, key, path+"{key}")
+			testNoNilNodes(t, v.MapIndex(key), path+"{value}")
+		}
+	}
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	if s.TokenLiteral() != "let" {
 		t.Errorf("s.TokenLiteral not 'let'. got=%q", s.TokenLiteral())
@@ -1081,3 +1585,44 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	}
 	t.FailNow()
 }
+
+// benchmarkProgram is one of the programs in testdata/bench at the root of
+// the repository
+type benchmarkProgram struct {
+	name   string
+	source string
+}
+
+func benchmarkPrograms(b *testing.B) []benchmarkProgram {
+	files, err := filepath.Glob(filepath.Join("..", "testdata", "bench", "*.grr"))
+	if err != nil || len(files) == 0 {
+		b.Fatalf("no benchmark programs: %v", err)
+	}
+
+	var programs []benchmarkProgram
+	for _, file := range files {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+		name := strings.TrimSuffix(filepath.Base(file), ".grr")
+		programs = append(programs, benchmarkProgram{name, string(source)})
+	}
+	return programs
+}
+
+func BenchmarkParseProgram(b *testing.B) {
+	for _, program := range benchmarkPrograms(b) {
+		b.Run(program.name, func(b *testing.B) {
+			b.SetBytes(int64(len(program.source)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				p := New(lexer.New(program.source))
+				p.ParseProgram()
+				if len(p.Errors()) != 0 {
+					b.Fatalf("parser errors: %q", p.Errors())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+// Package pprof writes Monke profiles in the format `go tool pprof` reads: a
+// gzipped profile.proto message. The few protobuf messages involved are
+// encoded by hand.
+package pprof
+
+import (
+	"compress/gzip"
+	"io"
+	"monke/evaluator"
+)
+
+// field numbers from profile.proto
+const (
+	PROFILE_SAMPLE_TYPE         = 1
+	PROFILE_SAMPLE              = 2
+	PROFILE_LOCATION            = 4
+	PROFILE_FUNCTION            = 5
+	PROFILE_STRING_TABLE        = 6
+	PROFILE_TIME_NANOS          = 9
+	PROFILE_DURATION_NANOS      = 10
+	PROFILE_PERIOD_TYPE         = 11
+	PROFILE_PERIOD              = 12
+	PROFILE_DEFAULT_SAMPLE_TYPE = 14
+
+	VALUE_TYPE_TYPE = 1
+	VALUE_TYPE_UNIT = 2
+
+	SAMPLE_LOCATION_ID = 1
+	SAMPLE_VALUE       = 2
+
+	LOCATION_ID   = 1
+	LOCATION_LINE = 4
+
+	LINE_FUNCTION_ID = 1
+	LINE_LINE        = 2
+
+	FUNCTION_ID          = 1
+	FUNCTION_NAME        = 2
+	FUNCTION_SYSTEM_NAME = 3
+	FUNCTION_FILENAME    = 4
+	FUNCTION_START_LINE  = 5
+)
+
+// Write writes p to w as a gzipped pprof profile. Every sample has the calls
+// made, the time spent and the values created, with time as the default.
+// Each function gets a location of its own, so pprof shows functions rather
+// than lines.
+func Write(w io.Writer, p *evaluator.Profile) error {
+	table := newStringTable()
+	var profile message
+
+	for _, st := range [][2]string{{"calls", "count"}, {"time", "nanoseconds"}, {"allocations", "count"}} {
+		var vt message
+		vt.int64(VALUE_TYPE_TYPE, table.index(st[0]))
+		vt.int64(VALUE_TYPE_UNIT, table.index(st[1]))
+		profile.message(PROFILE_SAMPLE_TYPE, &vt)
+	}
+
+	for _, s := range p.Samples {
+		var sample message
+		ids := make([]uint64, len(s.Stack))
+		for i, fn := range s.Stack {
+			ids[i] = uint64(fn.ID)
+		}
+		sample.packedUint64(SAMPLE_LOCATION_ID, ids)
+		sample.packedInt64(SAMPLE_VALUE, []int64{s.Calls, int64(s.Time), s.Allocations})
+		profile.message(PROFILE_SAMPLE, &sample)
+	}
+
+	for _, fn := range p.Functions {
+		var line message
+		line.uint64(LINE_FUNCTION_ID, uint64(fn.ID))
+		line.int64(LINE_LINE, int64(fn.Line))
+
+		var location message
+		location.uint64(LOCATION_ID, uint64(fn.ID))
+		location.message(LOCATION_LINE, &line)
+		profile.message(PROFILE_LOCATION, &location)
+	}
+
+	for _, fn := range p.Functions {
+		var function message
+		function.uint64(FUNCTION_ID, uint64(fn.ID))
+		function.int64(FUNCTION_NAME, table.index(fn.Name))
+		function.int64(FUNCTION_SYSTEM_NAME, table.index(fn.Name))
+		function.int64(FUNCTION_FILENAME, table.index(fn.File))
+		function.int64(FUNCTION_START_LINE, int64(fn.Line))
+		profile.message(PROFILE_FUNCTION, &function)
+	}
+
+	profile.int64(PROFILE_TIME_NANOS, p.Start.UnixNano())
+	profile.int64(PROFILE_DURATION_NANOS, int64(p.Duration))
+
+	var period message
+	period.int64(VALUE_TYPE_TYPE, table.index("time"))
+	period.int64(VALUE_TYPE_UNIT, table.index("nanoseconds"))
+	profile.message(PROFILE_PERIOD_TYPE, &period)
+	profile.int64(PROFILE_PERIOD, 1)
+	profile.int64(PROFILE_DEFAULT_SAMPLE_TYPE, table.index("time"))
+
+	// the string table goes last since the rest adds to it
+	for _, s := range table.strings {
+		profile.string(PROFILE_STRING_TABLE, s)
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(profile.buf); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// stringTable numbers the strings of a profile. The empty string has to be
+// the first.
+type stringTable struct {
+	strings []string
+	indexes map[string]int64
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{strings: []string{""}, indexes: map[string]int64{"": 0}}
+}
+
+func (t *stringTable) index(s string) int64 {
+	i, ok := t.indexes[s]
+	if !ok {
+		i = int64(len(t.strings))
+		t.strings = append(t.strings, s)
+		t.indexes[s] = i
+	}
+	return i
+}
+
+// message is an encoded protobuf message being built
+type message struct {
+	buf []byte
+}
+
+// wire types
+const (
+	VARINT = 0
+	BYTES  = 2
+)
+
+func (m *message) varint(v uint64) {
+	for v >= 0x80 {
+		m.buf = append(m.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	m.buf = append(m.buf, byte(v))
+}
+
+func (m *message) key(field, wireType int) {
+	m.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+// zero values are left out, as protobuf does
+func (m *message) uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	m.key(field, VARINT)
+	m.varint(v)
+}
+
+func (m *message) int64(field int, v int64) {
+	m.uint64(field, uint64(v))
+}
+
+func (m *message) bytes(field int, b []byte) {
+	m.key(field, BYTES)
+	m.varint(uint64(len(b)))
+	m.buf = append(m.buf, b...)
+}
+
+// strings are written even when empty, since the string table depends on
+// their positions
+func (m *message) string(field int, s string) {
+	m.bytes(field, []byte(s))
+}
+
+func (m *message) message(field int, msg *message) {
+	m.bytes(field, msg.buf)
+}
+
+func (m *message) packedUint64(field int, values []uint64) {
+	var packed message
+	for _, v := range values {
+		packed.varint(v)
+	}
+	m.bytes(field, packed.buf)
+}
+
+func (m *message) packedInt64(field int, values []int64) {
+	var packed message
+	for _, v := range values {
+		packed.varint(uint64(v))
+	}
+	m.bytes(field, packed.buf)
+}
@@ -0,0 +1,131 @@
+package pprof
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"monke/evaluator"
+	"monke/lexer"
+	"monke/object"
+	"monke/parser"
+	"testing"
+)
+
+// field is one field of a decoded protobuf message
+type field struct {
+	number int
+	value  uint64 // for varints
+	bytes  []byte // for length delimited fields
+}
+
+// decodes the fields of a message, which only has varint and length
+// delimited fields
+func decode(t *testing.T, buf []byte) []field {
+	t.Helper()
+
+	varint := func() uint64 {
+		var v uint64
+		for shift := uint(0); ; shift += 7 {
+			if len(buf) == 0 {
+				t.Fatalf("truncated varint")
+			}
+			b := buf[0]
+			buf = buf[1:]
+			v |= uint64(b&0x7f) << shift
+			if b < 0x80 {
+				return v
+			}
+		}
+	}
+
+	var fields []field
+	for len(buf) > 0 {
+		key := varint()
+		f := field{number: int(key >> 3)}
+		switch key & 7 {
+		case VARINT:
+			f.value = varint()
+		case BYTES:
+			n := varint()
+			f.bytes, buf = buf[:n], buf[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func TestWrite(t *testing.T) {
+	in := evaluator.New()
+	in.File = "main.grr"
+	in.StartProfile()
+	program := parser.New(lexer.New("fn f(n) { if (n > 0) { f(n - 1) } }; f(2); len([])")).ParseProgram()
+	in.Eval(program, object.NewEnvironment())
+	p := in.StopProfile()
+
+	var out bytes.Buffer
+	if err := Write(&out, p); err != nil {
+		t.Fatalf("Write returned error: %s", err)
+	}
+
+	gz, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("output isn't gzipped: %s", err)
+	}
+	raw, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("could not decompress the output: %s", err)
+	}
+
+	var strings []string
+	var sampleTypes, samples, locations, functions int
+	for _, f := range decode(t, raw) {
+		switch f.number {
+		case PROFILE_STRING_TABLE:
+			strings = append(strings, string(f.bytes))
+		case PROFILE_SAMPLE_TYPE:
+			sampleTypes++
+		case PROFILE_SAMPLE:
+			samples++
+			values := 0
+			for _, sf := range decode(t, f.bytes) {
+				if sf.number != SAMPLE_VALUE {
+					continue
+				}
+				// packed varints, each ending in a byte without the high bit
+				for _, b := range sf.bytes {
+					if b < 0x80 {
+						values++
+					}
+				}
+			}
+			if values != 3 {
+				t.Errorf("expected 3 values per sample, got %d", values)
+			}
+		case PROFILE_LOCATION:
+			locations++
+		case PROFILE_FUNCTION:
+			functions++
+		}
+	}
+
+	if len(strings) == 0 || strings[0] != "" {
+		t.Fatalf("the string table has to start with the empty string, got %q", strings)
+	}
+	for _, want := range []string{"time", "nanoseconds", "calls", "allocations", "f", "len", "(top level)", "main.grr"} {
+		found := false
+		for _, s := range strings {
+			found = found || s == want
+		}
+		if !found {
+			t.Errorf("string table is missing %q: %q", want, strings)
+		}
+	}
+
+	// the top level, f and len, with f called at three depths
+	if sampleTypes != 3 || functions != 3 || locations != 3 || samples != 5 {
+		t.Errorf("wrong profile. sample types=%d functions=%d locations=%d samples=%d",
+			sampleTypes, functions, locations, samples)
+	}
+}
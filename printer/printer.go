@@ -0,0 +1,557 @@
+// Package printer turns syntax trees back into Monke source, laid out the one
+// way `monke fmt` lays out every file.
+package printer
+
+import (
+	"bytes"
+	"io"
+	"monke/ast"
+	"monke/diagnostic"
+	"monke/lexer"
+	"monke/parser"
+	"monke/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// what each level of nesting is indented with
+const INDENT = "    "
+
+// the precedence of literals and anything else that never needs parentheses,
+// above every level the parser has
+const ATOM = parser.INDEX + 1
+
+// ParseError is returned by Format for source that doesn't parse
+type ParseError struct {
+	Diagnostics []diagnostic.Diagnostic
+}
+
+func (e *ParseError) Error() string {
+	messages := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		messages[i] = d.String()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Format parses source and returns it formatted. Source with syntax errors is
+// left alone and a *ParseError is returned instead.
+func Format(source string) (string, error) {
+	l := lexer.New(source)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		return "", &ParseError{Diagnostics: p.Diagnostics()}
+	}
+
+	var out bytes.Buffer
+	if err := Fprint(&out, program, source); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// Fprint writes program to w. source is the text program was parsed from, so
+// that its comments and the blank lines between statements can be kept. It
+// may be empty for programs that were built rather than parsed.
+func Fprint(w io.Writer, program *ast.Program, source string) error {
+	p := &printer{out: &bytes.Buffer{}}
+
+	if source != "" {
+		l := lexer.New(source)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			p.tokens = append(p.tokens, tok)
+		}
+		p.comments = l.Comments()
+		p.printed = make([]bool, len(p.comments))
+	}
+
+	items := p.statements(program.Statements, 0, len(source))
+	for i := range items {
+		if i > 0 {
+			p.separate(items[i-1], items[i])
+		}
+		p.writeItem(items, i, false)
+	}
+	if len(items) > 0 {
+		p.out.WriteString("\n")
+	}
+
+	_, err := w.Write(p.out.Bytes())
+	return err
+}
+
+type printer struct {
+	out    *bytes.Buffer
+	indent int
+
+	// every token of the source, used to find where statements and blocks
+	// end since the tree doesn't record it
+	tokens   []token.Token
+	comments []token.Token
+	printed  []bool
+}
+
+// item is a statement or a comment on a line of its own. Lines are those of
+// the source, or 0 when there is none.
+type item struct {
+	stmt     ast.Statement // nil for comments
+	text     string
+	trailing string // a comment following the statement on its last line
+	line     int
+	endLine  int
+}
+
+func commentItem(c token.Token) item {
+	return item{text: c.Literal, line: c.Pos.Line, endLine: c.Pos.Line}
+}
+
+// lays out stmts along with the comments between offsets from and end
+func (p *printer) statements(stmts []ast.Statement, from, end int) []item {
+	var items []item
+
+	for i, stmt := range stmts {
+		first := statementToken(stmt)
+		next := end
+		if i+1 < len(stmts) {
+			next = statementToken(stmts[i+1]).Pos.Offset
+		}
+
+		for _, c := range p.takeComments(from, first.Pos.Offset) {
+			items = append(items, commentItem(c))
+		}
+
+		text := p.render(func() { p.statement(stmt) })
+		last := p.lastToken(first, next)
+
+		// comments inside the statement that no block inside it claimed,
+		// say in the middle of a hash literal, go above it
+		for _, c := range p.takeComments(first.Pos.Offset, last.Pos.Offset) {
+			items = append(items, item{text: c.Literal, line: first.Pos.Line, endLine: first.Pos.Line})
+		}
+
+		items = append(items, item{
+			stmt:     stmt,
+			text:     text,
+			trailing: p.takeTrailing(last, next),
+			line:     first.Pos.Line,
+			endLine:  last.Pos.Line,
+		})
+		from = last.Pos.Offset + 1
+	}
+
+	for _, c := range p.takeComments(from, end) {
+		items = append(items, commentItem(c))
+	}
+
+	return items
+}
+
+// starts a new line before next, keeping a single blank line if there was
+// at least one in the source
+func (p *printer) separate(prev, next item) {
+	if prev.endLine > 0 && next.line > prev.endLine+1 {
+		p.out.WriteString("\n")
+	}
+	p.newline()
+}
+
+func (p *printer) writeItem(items []item, i int, inBlock bool) {
+	p.out.WriteString(items[i].text)
+	if p.needsSemicolon(items, i, inBlock) {
+		p.out.WriteString(";")
+	}
+	if items[i].trailing != "" {
+		p.out.WriteString(" " + items[i].trailing)
+	}
+}
+
+// Expression statements end in a semicolon, except for the last one in a
+// block, whose value is the block's value, and for ifs and trys that can't
+// be mistaken for the start of an expression continuing on the next line.
+func (p *printer) needsSemicolon(items []item, i int, inBlock bool) bool {
+	stmt, ok := items[i].stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+
+	var next *item
+	for j := i + 1; j < len(items); j++ {
+		if items[j].stmt != nil {
+			next = &items[j]
+			break
+		}
+	}
+
+	if next == nil && inBlock {
+		return false
+	}
+
+	switch stmt.Expression.(type) {
+	case *ast.IfExpression, *ast.TryExpression:
+		return next != nil && strings.IndexAny(next.text[:1], "([-") == 0
+	}
+	return true
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.out.WriteString("let " + stmt.Name.Value + " = ")
+		p.expression(stmt.Value, parser.LOWEST)
+		p.out.WriteString(";")
+	case *ast.ReturnStatement:
+		p.out.WriteString("return")
+		if stmt.ReturnValue != nil {
+			p.out.WriteString(" ")
+			p.expression(stmt.ReturnValue, parser.LOWEST)
+		}
+		p.out.WriteString(";")
+	case *ast.ThrowStatement:
+		p.out.WriteString("throw ")
+		p.expression(stmt.Value, parser.LOWEST)
+		p.out.WriteString(";")
+	case *ast.FunctionDeclaration:
+		p.expression(stmt.Function, parser.LOWEST)
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression, parser.LOWEST)
+	}
+}
+
+// writes e, in parentheses if it binds less tightly than prec
+func (p *printer) expression(e ast.Expression, prec int) {
+	if precedence(e) < prec {
+		p.out.WriteString("(")
+		defer p.out.WriteString(")")
+	}
+
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.out.WriteString(e.Value)
+	case *ast.IntegerLiteral:
+		p.out.WriteString(strconv.FormatInt(e.Value, 10))
+	case *ast.Boolean:
+		p.out.WriteString(strconv.FormatBool(e.Value))
+	case *ast.StringLiteral:
+		p.out.WriteString(`"` + e.Value + `"`)
+	case *ast.PrefixExpression:
+		p.out.WriteString(e.Operator)
+		p.expression(e.Right, parser.PREFIX)
+	case *ast.InfixExpression:
+		// operators are left associative, so only the right side needs
+		// parentheses at the same precedence
+		prec := parser.Precedence(token.TokenType(e.Operator))
+		p.expression(e.Left, prec)
+		p.out.WriteString(" " + e.Operator + " ")
+		p.expression(e.Right, prec+1)
+	case *ast.IfExpression:
+		p.out.WriteString("if (")
+		p.expression(e.Condition, parser.LOWEST)
+		blocks, before := []*ast.BlockStatement{e.Consequence}, []string{") "}
+		if e.Alternative != nil {
+			blocks, before = append(blocks, e.Alternative), append(before, " else ")
+		}
+		p.blocks(blocks, before)
+	case *ast.TryExpression:
+		blocks, before := []*ast.BlockStatement{e.Block}, []string{"try "}
+		if e.Catch != nil {
+			blocks, before = append(blocks, e.Catch), append(before, " catch ("+e.CatchParam.Value+") ")
+		}
+		if e.Finally != nil {
+			blocks, before = append(blocks, e.Finally), append(before, " finally ")
+		}
+		p.blocks(blocks, before)
+	case *ast.FunctionLiteral:
+		p.out.WriteString("fn")
+		if e.Name != nil {
+			p.out.WriteString(" " + e.Name.Value)
+		}
+		p.out.WriteString("(")
+		for i, param := range e.Parameters {
+			if i > 0 {
+				p.out.WriteString(", ")
+			}
+			p.out.WriteString(param.Value)
+			if value := e.Default(i); value != nil {
+				p.out.WriteString(" = ")
+				p.expression(value, parser.LOWEST)
+			}
+		}
+		if e.Rest != nil {
+			if len(e.Parameters) > 0 {
+				p.out.WriteString(", ")
+			}
+			p.out.WriteString("..." + e.Rest.Value)
+		}
+		p.out.WriteString(") ")
+		p.block(e.Body)
+	case *ast.CallExpression:
+		p.expression(e.Function, parser.CALL)
+		p.out.WriteString("(")
+		p.list(e.Arguments)
+		p.out.WriteString(")")
+	case *ast.IndexExpression:
+		// calls and indexes chain left to right like f(x)[0](y)
+		p.expression(e.Left, parser.CALL)
+		p.out.WriteString("[")
+		p.expression(e.Index, parser.LOWEST)
+		p.out.WriteString("]")
+	case *ast.ArrayLiteral:
+		p.out.WriteString("[")
+		p.list(e.Elements)
+		p.out.WriteString("]")
+	case *ast.HashLiteral:
+		p.out.WriteString("{")
+		for i, key := range sortedKeys(e) {
+			if i > 0 {
+				p.out.WriteString(", ")
+			}
+			p.expression(key, parser.LOWEST)
+			p.out.WriteString(": ")
+			p.expression(e.Pairs[key], parser.LOWEST)
+		}
+		p.out.WriteString("}")
+	case *ast.ImportExpression:
+		p.out.WriteString(`import "` + e.Path.Value + `"`)
+	}
+}
+
+func (p *printer) list(exprs []ast.Expression) {
+	for i, e := range exprs {
+		if i > 0 {
+			p.out.WriteString(", ")
+		}
+		p.expression(e, parser.LOWEST)
+	}
+}
+
+func (p *printer) block(b *ast.BlockStatement) {
+	items := p.blockItems(b)
+	p.writeBlock(items, fitsOnLine(items))
+}
+
+// writes the blocks of an if or try expression, which go on one line only
+// if they all fit on one, with what goes before each of them
+func (p *printer) blocks(blocks []*ast.BlockStatement, before []string) {
+	items := make([][]item, len(blocks))
+	oneLine := true
+	for i, b := range blocks {
+		items[i] = p.blockItems(b)
+		oneLine = oneLine && fitsOnLine(items[i])
+	}
+
+	for i := range blocks {
+		p.out.WriteString(before[i])
+		p.writeBlock(items[i], oneLine)
+	}
+}
+
+// lays out the statements of b along with the comments inside it
+func (p *printer) blockItems(b *ast.BlockStatement) []item {
+	end := p.blockEnd(b)
+
+	p.indent++
+	defer func() { p.indent-- }()
+	return p.statements(b.Statements, b.Token.Pos.Offset+1, end)
+}
+
+// Blocks go on one line if they hold a single statement with no blocks of
+// its own, and are spread over several otherwise, however they were written.
+func fitsOnLine(items []item) bool {
+	return len(items) == 0 ||
+		len(items) == 1 && items[0].stmt != nil && items[0].trailing == "" && !hasBlock(items[0].stmt)
+}
+
+func (p *printer) writeBlock(items []item, oneLine bool) {
+	if len(items) == 0 {
+		p.out.WriteString("{}")
+		return
+	}
+
+	if oneLine {
+		p.out.WriteString("{ ")
+		p.writeItem(items, 0, true)
+		p.out.WriteString(" }")
+		return
+	}
+
+	p.out.WriteString("{")
+	p.indent++
+	for i := range items {
+		if i > 0 {
+			p.separate(items[i-1], items[i])
+		} else {
+			p.newline()
+		}
+		p.writeItem(items, i, true)
+	}
+	p.indent--
+	p.newline()
+	p.out.WriteString("}")
+}
+
+func (p *printer) newline() {
+	p.out.WriteString("\n" + strings.Repeat(INDENT, p.indent))
+}
+
+// returns what f prints instead of printing it
+func (p *printer) render(f func()) string {
+	saved := p.out
+	p.out = &bytes.Buffer{}
+	f()
+	text := p.out.String()
+	p.out = saved
+	return text
+}
+
+// returns the comments between offsets from and to that haven't been
+// printed yet, marking them as printed
+func (p *printer) takeComments(from, to int) []token.Token {
+	var comments []token.Token
+	for i, c := range p.comments {
+		if !p.printed[i] && from <= c.Pos.Offset && c.Pos.Offset < to {
+			p.printed[i] = true
+			comments = append(comments, c)
+		}
+	}
+	return comments
+}
+
+// returns the comment on the same line after last, if there is one before
+// offset next
+func (p *printer) takeTrailing(last token.Token, next int) string {
+	for i, c := range p.comments {
+		if !p.printed[i] && last.Pos.Offset < c.Pos.Offset && c.Pos.Offset < next &&
+			c.Pos.Line == last.Pos.Line {
+			p.printed[i] = true
+			return c.Literal
+		}
+	}
+	return ""
+}
+
+// returns the last token before offset next, which ends the statement
+// starting with first
+func (p *printer) lastToken(first token.Token, next int) token.Token {
+	i := sort.Search(len(p.tokens), func(i int) bool { return p.tokens[i].Pos.Offset >= next })
+	if i == 0 || p.tokens[i-1].Pos.Offset < first.Pos.Offset {
+		return first
+	}
+	return p.tokens[i-1]
+}
+
+// returns the offset of the brace closing b
+func (p *printer) blockEnd(b *ast.BlockStatement) int {
+	i := sort.Search(len(p.tokens), func(i int) bool { return p.tokens[i].Pos.Offset >= b.Token.Pos.Offset })
+
+	depth := 0
+	for ; i < len(p.tokens); i++ {
+		switch p.tokens[i].Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+			if depth == 0 {
+				return p.tokens[i].Pos.Offset
+			}
+		}
+	}
+	return b.Token.Pos.Offset
+}
+
+// reports whether there is a block anywhere inside stmt
+func hasBlock(stmt ast.Statement) bool {
+	found := false
+	ast.Inspect(stmt, func(node ast.Node) bool {
+		if _, ok := node.(*ast.BlockStatement); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+func statementToken(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token
+	case *ast.ReturnStatement:
+		return stmt.Token
+	case *ast.ThrowStatement:
+		return stmt.Token
+	case *ast.FunctionDeclaration:
+		return stmt.Token
+	case *ast.ExpressionStatement:
+		return stmt.Token
+	}
+	return token.Token{}
+}
+
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(token.TokenType(e.Operator))
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.CallExpression:
+		return parser.CALL
+	case *ast.IndexExpression:
+		return parser.INDEX
+	}
+	return ATOM
+}
+
+// returns the keys of h in the order they were written, which is lost when
+// they are put in a map
+func sortedKeys(h *ast.HashLiteral) []ast.Expression {
+	keys := make([]ast.Expression, 0, len(h.Pairs))
+	for key := range h.Pairs {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := firstOffset(keys[i]), firstOffset(keys[j])
+		if a != b {
+			return a < b
+		}
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
+}
+
+// returns where the source of e starts
+func firstOffset(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return firstOffset(e.Left)
+	case *ast.CallExpression:
+		return firstOffset(e.Function)
+	case *ast.IndexExpression:
+		return firstOffset(e.Left)
+	case *ast.Identifier:
+		return e.Token.Pos.Offset
+	case *ast.IntegerLiteral:
+		return e.Token.Pos.Offset
+	case *ast.Boolean:
+		return e.Token.Pos.Offset
+	case *ast.StringLiteral:
+		return e.Token.Pos.Offset
+	case *ast.PrefixExpression:
+		return e.Token.Pos.Offset
+	case *ast.IfExpression:
+		return e.Token.Pos.Offset
+	case *ast.TryExpression:
+		return e.Token.Pos.Offset
+	case *ast.FunctionLiteral:
+		return e.Token.Pos.Offset
+	case *ast.ArrayLiteral:
+		return e.Token.Pos.Offset
+	case *ast.HashLiteral:
+		return e.Token.Pos.Offset
+	case *ast.ImportExpression:
+		return e.Token.Pos.Offset
+	}
+	return 0
+}
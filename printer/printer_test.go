@@ -0,0 +1,246 @@
+package printer
+
+import (
+	"bytes"
+	"monke/ast"
+	"monke/lexer"
+	"monke/parser"
+	"monke/token"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=5*5", "let x = 5 * 5;\n"},
+		{"return x+1", "return x + 1;\n"},
+		{"throw {\"message\":\"no\"}", "throw {\"message\": \"no\"};\n"},
+		{"-a*b", "-a * b;\n"},
+		{"-(a*b)", "-(a * b);\n"},
+		{"a-(b-c)", "a - (b - c);\n"},
+		{"(a-b)-c", "a - b - c;\n"},
+		{"(a+b)(1)[0]", "(a + b)(1)[0];\n"},
+		{"(-a)[0]", "(-a)[0];\n"},
+		{"!(a==b)", "!(a == b);\n"},
+		{"fn(x,y){x+y}(1,2)", "fn(x, y) { x + y }(1, 2);\n"},
+		{"let s = \"hello world\";", "let s = \"hello world\";\n"},
+		{"{\"b\": 2, \"a\": 1, 1+1: 3}", "{\"b\": 2, \"a\": 1, 1 + 1: 3};\n"},
+		{"let m = import \"lib/math.grr\"", "let m = import \"lib/math.grr\";\n"},
+		{"if(x){}else{y}", "if (x) {} else { y }\n"},
+		{"fn(a,b=1+1,...rest){a}", "fn(a, b = 1 + 1, ...rest) { a };\n"},
+		{"fn(...all){}", "fn(...all) {};\n"},
+		{"fn add(a,b){a+b};add(1,2)", "fn add(a, b) { a + b }\nadd(1, 2);\n"},
+		{"fn f() {}\n(1)", "fn f() {}\n1;\n"},
+		{"if (x) { 1 }; -1", "if (x) { 1 };\n-1;\n"},
+		{"if (x) { 1 }; puts(2)", "if (x) { 1 }\nputs(2);\n"},
+		{
+			"let f = fn(x) {\nlet y = x * 2; return y;\n}",
+			"let f = fn(x) {\n    let y = x * 2;\n    return y;\n};\n",
+		},
+		{
+			"try { risky() } catch (e) { e[\"message\"] } finally { cleanup(); }",
+			"try { risky() } catch (e) { e[\"message\"] } finally { cleanup() }\n",
+		},
+		{
+			"fn() {\n  if (a) {\n  b\n  }\n}",
+			"fn() {\n    if (a) { b }\n};\n",
+		},
+		{"let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;", "let a = 1;\n\nlet b = 2;\nlet c = 3;\n"},
+		{"", ""},
+	}
+
+	for i, tt := range tests {
+		actual, err := Format(tt.input)
+		if err != nil {
+			t.Errorf("tests[%d]: unexpected error: %s", i, err)
+			continue
+		}
+		if actual != tt.expected {
+			t.Errorf("tests[%d]: wrong output for %q.\nexpected=%q\ngot=%q", i, tt.input, tt.expected, actual)
+		}
+	}
+}
+
+// the layout comes from the tree, so the same program written on one line or
+// spread over many is formatted the same
+func TestFormatIgnoresLayout(t *testing.T) {
+	tests := []struct {
+		inputs   []string
+		expected string
+	}{
+		{
+			[]string{
+				"let f = fn(x) { if (x > 1) { x * f(x - 1) } else { 1 } }; puts(f(5));",
+				"let f = fn(x)\n{\n  if (x > 1)\n  {\n    x * f(x - 1)\n  }\n  else { 1 }\n}\n;puts(\n  f(5)\n)",
+			},
+			"let f = fn(x) {\n    if (x > 1) { x * f(x - 1) } else { 1 }\n};\nputs(f(5));\n",
+		},
+		{
+			[]string{
+				"fn g(a) { let b = a * 2; b }",
+				"fn g(a) {\n  let b =\n    a * 2; b }",
+			},
+			"fn g(a) {\n    let b = a * 2;\n    b\n}\n",
+		},
+		{
+			[]string{
+				"try { risky() } catch (e) { puts(e); 1 }",
+				"try {\n  risky()\n} catch (e) { puts(e); 1 }",
+			},
+			"try {\n    risky()\n} catch (e) {\n    puts(e);\n    1\n}\n",
+		},
+	}
+
+	for i, tt := range tests {
+		for _, input := range tt.inputs {
+			actual, err := Format(input)
+			if err != nil {
+				t.Errorf("tests[%d]: unexpected error: %s", i, err)
+				continue
+			}
+			if actual != tt.expected {
+				t.Errorf("tests[%d]: wrong output for %q.\nexpected=%q\ngot=%q", i, input, tt.expected, actual)
+			}
+		}
+	}
+}
+
+func TestFormatComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"// only a comment", "// only a comment\n"},
+		{"let x = 1; // one\nx", "let x = 1; // one\nx;\n"},
+		{
+			"// header\n\nlet x = 1;\n// about y\nlet y = 2;\n// footer",
+			"// header\n\nlet x = 1;\n// about y\nlet y = 2;\n// footer\n",
+		},
+		{
+			"let f = fn(x) { // doubles x\n  x * 2 // the result\n  // nothing after\n};",
+			"let f = fn(x) {\n    // doubles x\n    x * 2 // the result\n    // nothing after\n};\n",
+		},
+		{
+			"let h = {\n  \"a\": 1, // first\n  \"b\": 2\n};",
+			"// first\nlet h = {\"a\": 1, \"b\": 2};\n",
+		},
+		{"fn() {\n  // empty\n}", "fn() {\n    // empty\n};\n"},
+		{
+			"if (x) {\n  a // in the consequence\n} else {\n  b\n} // after",
+			"if (x) {\n    a // in the consequence\n} else {\n    b\n} // after\n",
+		},
+	}
+
+	for i, tt := range tests {
+		actual, err := Format(tt.input)
+		if err != nil {
+			t.Errorf("tests[%d]: unexpected error: %s", i, err)
+			continue
+		}
+		if actual != tt.expected {
+			t.Errorf("tests[%d]: wrong output for %q.\nexpected=%q\ngot=%q", i, tt.input, tt.expected, actual)
+		}
+	}
+}
+
+// formatting anything twice gives the same result as formatting it once, and
+// never changes what the program means
+func TestFormatIdempotent(t *testing.T) {
+	inputs := []string{
+		"let f = fn(x) {return x*x;};\nf(129037812);",
+		"let people = [{\"name\": \"Alice\", \"age\": 24}, {\"name\": \"Anna\", \"age\": 28}];\npeople[0][\"name\"];",
+		"let map = fn(arr, f) { let iter = fn(arr, acc) { if (len(arr) == 0) { acc } else { iter(rest(arr), push(acc, f(first(arr)))) } }; iter(arr, []) };",
+		"let a = 1; // one\n\n\n// two\nlet b = fn() {\n// inside\n\n  a + 1 // trailing\n\n};\n",
+		"if (1 < 2) { 10 } else { 20 }\n-1",
+		"try { throw {\"message\": \"boom\"}; } catch (err) { err[\"message\"] } finally { puts(\"done\") }",
+		"-(1 + 2) * !true / ((3 - 4) - (5 - 6))",
+		"fn(x) {}\n(1)",
+		"let h = {\n  1: \"one\", // comment\n  true: fn(x) { // weird\n    x\n  }\n}",
+		"import \"a.grr\"[\"b\"](1, 2)",
+	}
+
+	for i, input := range inputs {
+		once, err := Format(input)
+		if err != nil {
+			t.Fatalf("inputs[%d]: unexpected error: %s", i, err)
+		}
+
+		twice, err := Format(once)
+		if err != nil {
+			t.Fatalf("inputs[%d]: formatted output doesn't parse: %s\n%s", i, err, once)
+		}
+		if once != twice {
+			t.Errorf("inputs[%d]: formatting isn't idempotent.\nonce=%q\ntwice=%q", i, once, twice)
+		}
+
+		if original, formatted := parse(t, input), parse(t, once); original.String() != formatted.String() {
+			t.Errorf("inputs[%d]: formatting changed the program.\nbefore=%q\nafter=%q", i, original.String(), formatted.String())
+		}
+
+		if countComments(input) != countComments(once) {
+			t.Errorf("inputs[%d]: comments were lost.\n%s", i, once)
+		}
+	}
+}
+
+func TestFormatParseError(t *testing.T) {
+	_, err := Format("let x 5;")
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected *ParseError, got %T (%v)", err, err)
+	}
+	if len(perr.Diagnostics) == 0 {
+		t.Errorf("ParseError has no diagnostics")
+	}
+}
+
+// programs built by hand have no source to take comments or layout from
+func TestFprintWithoutSource(t *testing.T) {
+	program := &ast.Program{
+		Statements: []ast.Statement{
+			&ast.LetStatement{
+				Name: &ast.Identifier{Value: "f"},
+				Value: &ast.FunctionLiteral{
+					Parameters: []*ast.Identifier{{Value: "x"}},
+					Body: &ast.BlockStatement{
+						Statements: []ast.Statement{
+							&ast.ExpressionStatement{Expression: &ast.InfixExpression{
+								Operator: "*",
+								Left:     &ast.Identifier{Value: "x"},
+								Right:    &ast.IntegerLiteral{Value: 2},
+							}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := Fprint(&out, program, ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := "let f = fn(x) { x * 2 };\n"
+	if out.String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func countComments(input string) int {
+	l := lexer.New(input)
+	for l.NextToken().Type != token.EOF {
+	}
+	return len(l.Comments())
+}
@@ -0,0 +1,256 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"monke/ast"
+	"monke/evaluator"
+	"monke/lexer"
+	"monke/object"
+	"monke/parser"
+	"monke/token"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// session is the state a REPL keeps between inputs
+type session struct {
+	in          *bufio.Reader
+	out         io.Writer
+	env         *object.Environment
+	interpreter *evaluator.Interpreter
+}
+
+func newSession(in *bufio.Reader, out io.Writer) *session {
+	s := &session{in: in, out: out}
+	s.reset()
+	return s
+}
+
+// starts over with an empty environment and a fresh interpreter
+func (s *session) reset() {
+	s.env = object.NewEnvironment()
+	s.interpreter = evaluator.New()
+	s.interpreter.Stdin = s.in
+	s.interpreter.Stdout = s.out
+}
+
+// parses input and reports any parser errors
+func (s *session) parse(input string) (*ast.Program, bool) {
+	l := lexer.New(input)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, "", input, p.Diagnostics())
+		return nil, false
+	}
+
+	return program, true
+}
+
+func (s *session) print(evaluated object.Object) {
+	if evaluated != nil {
+		io.WriteString(s.out, evaluated.Inspect())
+		io.WriteString(s.out, "\n")
+	}
+}
+
+type command struct {
+	usage string
+	help  string
+	// run executes the command with whatever followed its name. It returns
+	// false if the REPL should exit.
+	run func(s *session, arg string) bool
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"env":    {":env", "list the bindings in the current environment", (*session).cmdEnv},
+		"type":   {":type <expr>", "print the type of the value of expr", (*session).cmdType},
+		"ast":    {":ast <expr>", "print the syntax tree of expr", (*session).cmdAST},
+		"tokens": {":tokens <expr>", "print the tokens expr is lexed into", (*session).cmdTokens},
+		"load":   {":load <file>", "evaluate a file in the current environment", (*session).cmdLoad},
+		"reset":  {":reset", "clear all bindings", (*session).cmdReset},
+		"time":   {":time <expr>", "evaluate expr and print how long it took", (*session).cmdTime},
+		"help":   {":help", "list the available commands", (*session).cmdHelp},
+		"quit":   {":quit", "exit the REPL", (*session).cmdQuit},
+	}
+}
+
+// REPL commands start with a colon, which can't begin any Monke expression
+func isCommand(input string) bool {
+	return strings.HasPrefix(strings.TrimSpace(input), ":")
+}
+
+// runs a colon command. It returns false if the REPL should exit.
+func (s *session) runCommand(input string) bool {
+	input = strings.TrimPrefix(strings.TrimSpace(input), ":")
+
+	name, arg := input, ""
+	if idx := strings.IndexAny(input, " \t\n"); idx >= 0 {
+		name, arg = input[:idx], strings.TrimSpace(input[idx+1:])
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(s.out, "unknown command :%s, try :help\n", name)
+		return true
+	}
+
+	return cmd.run(s, arg)
+}
+
+func (s *session) cmdEnv(arg string) bool {
+	for _, name := range s.env.Names() {
+		val, _ := s.env.Get(name)
+		fmt.Fprintf(s.out, "%s: %s = %s\n", name, val.Type(), val.Inspect())
+	}
+	return true
+}
+
+func (s *session) cmdType(arg string) bool {
+	program, ok := s.parse(arg)
+	if !ok {
+		return true
+	}
+
+	evaluated := s.interpreter.Eval(program, s.env)
+	if evaluated == nil {
+		evaluated = evaluator.NULL
+	}
+	fmt.Fprintln(s.out, evaluated.Type())
+	return true
+}
+
+func (s *session) cmdAST(arg string) bool {
+	program, ok := s.parse(arg)
+	if !ok {
+		return true
+	}
+
+	printTree(s.out, reflect.ValueOf(program), "", 0)
+	return true
+}
+
+func (s *session) cmdTokens(arg string) bool {
+	l := lexer.New(arg)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(s.out, "%-10s %q\n", tok.Type, tok.Literal)
+	}
+	return true
+}
+
+func (s *session) cmdLoad(arg string) bool {
+	source, err := ioutil.ReadFile(arg)
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return true
+	}
+
+	program, ok := s.parse(string(source))
+	if !ok {
+		return true
+	}
+
+	dir := s.interpreter.Dir
+	s.interpreter.Dir = filepath.Dir(arg)
+	defer func() { s.interpreter.Dir = dir }()
+
+	s.print(s.interpreter.Eval(program, s.env))
+	return true
+}
+
+func (s *session) cmdReset(arg string) bool {
+	s.reset()
+	return true
+}
+
+func (s *session) cmdTime(arg string) bool {
+	program, ok := s.parse(arg)
+	if !ok {
+		return true
+	}
+
+	start := time.Now()
+	evaluated := s.interpreter.Eval(program, s.env)
+	elapsed := time.Since(start)
+
+	s.print(evaluated)
+	fmt.Fprintf(s.out, "time: %s\n", elapsed)
+	return true
+}
+
+func (s *session) cmdHelp(arg string) bool {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(s.out, "%-16s %s\n", commands[name].usage, commands[name].help)
+	}
+	return true
+}
+
+func (s *session) cmdQuit(arg string) bool {
+	return false
+}
+
+// the fields resolver.AssignSlots fills in for the evaluator, which say
+// nothing about the syntax
+var slotFields = map[string]bool{"Slot": true, "Locals": true, "CatchLocals": true, "Slotted": true}
+
+// prints v as an indented tree, one node or field per line. Tokens are left
+// out since the fields they end up in already show them, and so are slots.
+func printTree(out io.Writer, v reflect.Value, label string, depth int) {
+	indent := strings.Repeat("  ", depth)
+
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		fmt.Fprintf(out, "%s%snil\n", indent, label)
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		fmt.Fprintf(out, "%s%s%s\n", indent, label, v.Elem().Type().Name())
+		printFields(out, v.Elem(), depth+1)
+	case reflect.Slice:
+		fmt.Fprintf(out, "%s%s[%d]\n", indent, label, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			printTree(out, v.Index(i), "", depth+1)
+		}
+	case reflect.Map:
+		fmt.Fprintf(out, "%s%s{%d}\n", indent, label, v.Len())
+		for _, key := range v.MapKeys() {
+			printTree(out, key, "key: ", depth+1)
+			printTree(out, v.MapIndex(key), "value: ", depth+1)
+		}
+	case reflect.String:
+		fmt.Fprintf(out, "%s%s%q\n", indent, label, v.String())
+	default:
+		fmt.Fprintf(out, "%s%s%v\n", indent, label, v.Interface())
+	}
+}
+
+func printFields(out io.Writer, v reflect.Value, depth int) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Type == reflect.TypeOf(token.Token{}) || field.PkgPath != "" || slotFields[field.Name] {
+			continue
+		}
+
+		printTree(out, v.Field(i), field.Name+": ", depth)
+	}
+}
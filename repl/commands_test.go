@@ -0,0 +1,59 @@
+package repl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monke-repl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lib := filepath.Join(dir, "lib.grr")
+	if err := ioutil.WriteFile(lib, []byte("let y = 10;\nlet z = y * 2;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected []string
+		missing  []string
+	}{
+		{"let x = 5;\n:env\n", []string{"x: INTEGER = 5"}, nil},
+		{`:type "hi"` + "\n", []string{"STRING"}, nil},
+		{":type let x = 1\n", []string{"NULL"}, nil},
+		{":ast -a\n", []string{"PrefixExpression", `Operator: "-"`, `Value: "a"`}, nil},
+		{":ast fn(a) { try { a } catch (e) { e } }\n", []string{"FunctionLiteral", "CatchParam: Identifier"},
+			[]string{"Slot", "Locals", "CatchLocals", "Slotted"}},
+		{":tokens let x\n", []string{`LET        "let"`, `IDENT      "x"`}, nil},
+		{":load " + lib + "\nz\n", []string{"20"}, nil},
+		{"let x = 5;\n:reset\nx\n", []string{"identifier not found: x"}, nil},
+		{":time 1 + 1\n", []string{"2\n", "time: "}, nil},
+		{":nope\n", []string{"unknown command :nope"}, nil},
+		{":help\n", []string{":quit"}, nil},
+		{":quit\n99\n", nil, []string{"99"}},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out)
+
+		for _, want := range tt.expected {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("output of %q does not contain %q. got=%q", tt.input, want, out.String())
+			}
+		}
+		for _, unwanted := range tt.missing {
+			if strings.Contains(out.String(), unwanted) {
+				t.Errorf("output of %q contains %q. got=%q", tt.input, unwanted, out.String())
+			}
+		}
+	}
+}
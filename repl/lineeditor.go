@@ -0,0 +1,323 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// the file in the user's home directory that REPL history is kept in
+const HISTORY_FILE = ".monke_history"
+
+// the most history entries that are kept around
+const HISTORY_SIZE = 1000
+
+// errInterrupted is returned by ReadLine when the user presses Ctrl-C. The
+// REPL drops whatever was typed so far and starts over.
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads one line of input after showing prompt
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// plainReader is used when input is not a terminal, e.g. piped in
+type plainReader struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (r *plainReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+
+	line, err := r.in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// lineEditor reads lines from a terminal in raw mode and supports cursor
+// movement, the usual emacs style shortcuts and history.
+type lineEditor struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	// rawMode switches the terminal into raw mode while a line is read and
+	// returns a function to switch it back. It is nil for tests.
+	rawMode func() (func(), error)
+
+	history     []string
+	historyFile string
+
+	buf    []rune
+	cursor int
+	// position in history while browsing it, len(history) means the line
+	// being edited
+	histIdx int
+	// the line being edited before browsing history started
+	pending []rune
+}
+
+func newLineEditor(in *bufio.Reader, out io.Writer) *lineEditor {
+	return &lineEditor{in: in, out: out}
+}
+
+// loads history from path and appends every new entry to it from now on
+func (e *lineEditor) useHistoryFile(path string) {
+	e.historyFile = path
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	if len(e.history) > HISTORY_SIZE {
+		e.history = e.history[len(e.history)-HISTORY_SIZE:]
+	}
+}
+
+// returns the default history file location, or "" if there is no home
+// directory to keep it in
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, HISTORY_FILE)
+}
+
+func (e *lineEditor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+
+	e.history = append(e.history, line)
+	if len(e.history) > HISTORY_SIZE {
+		e.history = e.history[1:]
+	}
+
+	if e.historyFile == "" {
+		return
+	}
+	f, err := os.OpenFile(e.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+func (e *lineEditor) ReadLine(prompt string) (string, error) {
+	if e.rawMode != nil {
+		restore, err := e.rawMode()
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	e.buf = e.buf[:0]
+	e.cursor = 0
+	e.histIdx = len(e.history)
+	e.pending = nil
+	e.refresh(prompt)
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			line := string(e.buf)
+			io.WriteString(e.out, "\r\n")
+			e.addHistory(line)
+			return line, nil
+		case 3: // Ctrl-C
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupted
+		case 4: // Ctrl-D
+			if len(e.buf) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.deleteAt(e.cursor)
+		case 127, 8: // Backspace
+			if e.cursor > 0 {
+				e.cursor--
+				e.deleteAt(e.cursor)
+			}
+		case 1: // Ctrl-A
+			e.cursor = 0
+		case 5: // Ctrl-E
+			e.cursor = len(e.buf)
+		case 2: // Ctrl-B
+			e.moveCursor(-1)
+		case 6: // Ctrl-F
+			e.moveCursor(1)
+		case 11: // Ctrl-K
+			e.buf = e.buf[:e.cursor]
+		case 21: // Ctrl-U
+			e.buf = append(e.buf[:0], e.buf[e.cursor:]...)
+			e.cursor = 0
+		case 23: // Ctrl-W
+			e.deleteWord()
+		case 12: // Ctrl-L
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+		case 16: // Ctrl-P
+			e.browseHistory(-1)
+		case 14: // Ctrl-N
+			e.browseHistory(1)
+		case 27: // Escape sequence
+			e.handleEscape()
+		default:
+			if r >= 32 {
+				e.insert(r)
+			}
+		}
+
+		e.refresh(prompt)
+	}
+}
+
+// handles the arrow, home, end and delete keys, which terminals send as
+// escape sequences like ESC [ A
+func (e *lineEditor) handleEscape() {
+	kind, _, err := e.in.ReadRune()
+	if err != nil || (kind != '[' && kind != 'O') {
+		return
+	}
+
+	key, _, err := e.in.ReadRune()
+	if err != nil {
+		return
+	}
+
+	switch key {
+	case 'A':
+		e.browseHistory(-1)
+	case 'B':
+		e.browseHistory(1)
+	case 'C':
+		e.moveCursor(1)
+	case 'D':
+		e.moveCursor(-1)
+	case 'H':
+		e.cursor = 0
+	case 'F':
+		e.cursor = len(e.buf)
+	default:
+		// sequences like ESC [ 3 ~ carry a number before the final '~'
+		if key < '0' || key > '9' {
+			return
+		}
+		for {
+			next, _, err := e.in.ReadRune()
+			if err != nil || next == '~' {
+				break
+			}
+			if next < '0' || next > '9' {
+				return
+			}
+			key = next
+		}
+
+		switch key {
+		case '1', '7':
+			e.cursor = 0
+		case '4', '8':
+			e.cursor = len(e.buf)
+		case '3':
+			e.deleteAt(e.cursor)
+		}
+	}
+}
+
+func (e *lineEditor) insert(r rune) {
+	e.buf = append(e.buf, 0)
+	copy(e.buf[e.cursor+1:], e.buf[e.cursor:])
+	e.buf[e.cursor] = r
+	e.cursor++
+}
+
+func (e *lineEditor) deleteAt(pos int) {
+	if pos < 0 || pos >= len(e.buf) {
+		return
+	}
+	e.buf = append(e.buf[:pos], e.buf[pos+1:]...)
+}
+
+func (e *lineEditor) deleteWord() {
+	start := e.cursor
+	for start > 0 && e.buf[start-1] == ' ' {
+		start--
+	}
+	for start > 0 && e.buf[start-1] != ' ' {
+		start--
+	}
+	e.buf = append(e.buf[:start], e.buf[e.cursor:]...)
+	e.cursor = start
+}
+
+func (e *lineEditor) moveCursor(delta int) {
+	e.cursor += delta
+	if e.cursor < 0 {
+		e.cursor = 0
+	}
+	if e.cursor > len(e.buf) {
+		e.cursor = len(e.buf)
+	}
+}
+
+// moves delta entries through history, keeping the line that was being
+// edited so that coming back down restores it
+func (e *lineEditor) browseHistory(delta int) {
+	idx := e.histIdx + delta
+	if idx < 0 || idx > len(e.history) {
+		return
+	}
+
+	if e.histIdx == len(e.history) {
+		e.pending = append([]rune{}, e.buf...)
+	}
+
+	e.histIdx = idx
+	if idx == len(e.history) {
+		e.buf = append(e.buf[:0], e.pending...)
+	} else {
+		e.buf = append(e.buf[:0], []rune(e.history[idx])...)
+	}
+	e.cursor = len(e.buf)
+}
+
+// redraws the prompt and line and puts the terminal cursor where ours is
+func (e *lineEditor) refresh(prompt string) {
+	var out strings.Builder
+
+	out.WriteString("\r")
+	out.WriteString(prompt)
+	out.WriteString(string(e.buf))
+	out.WriteString("\x1b[K")
+	out.WriteString("\r")
+	if col := len([]rune(prompt)) + e.cursor; col > 0 {
+		fmt.Fprintf(&out, "\x1b[%dC", col)
+	}
+
+	io.WriteString(e.out, out.String())
+}
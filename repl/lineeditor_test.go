@@ -0,0 +1,103 @@
+package repl
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestLineEditorEditing(t *testing.T) {
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"abc\r", "abc"},
+		{"abc\x1b[D\x1b[DX\r", "aXbc"},
+		{"abc\x7f\x7f\r", "a"},
+		{"abc\x01X\x05Y\r", "XabcY"},
+		{"abc\x1b[H\x1b[3~\r", "bc"},
+		{"abc\x02\x02\x0b\r", "a"},
+		{"abc\x02\x15\r", "c"},
+		{"let foo bar\x17\x17\r", "let "},
+		{"héllo\x1b[D\x1b[D\x1b[D\x1b[D\x7f\r", "éllo"},
+	}
+
+	for _, tt := range tests {
+		e := newLineEditor(bufio.NewReader(strings.NewReader(tt.keys)), ioutil.Discard)
+
+		line, err := e.ReadLine(PROMPT)
+		if err != nil {
+			t.Fatalf("ReadLine(%q) returned error: %s", tt.keys, err)
+		}
+		if line != tt.expected {
+			t.Errorf("ReadLine(%q) wrong. expected=%q, got=%q", tt.keys, tt.expected, line)
+		}
+	}
+}
+
+func TestLineEditorHistory(t *testing.T) {
+	keys := "one\rtwo\r\x1b[A\x1b[A\r\x1b[A\x1b[A\x1b[Bx\r\x10\x10\x10\x0e\r"
+	e := newLineEditor(bufio.NewReader(strings.NewReader(keys)), ioutil.Discard)
+
+	expected := []string{"one", "two", "one", "onex", "one"}
+	for _, want := range expected {
+		line, err := e.ReadLine(PROMPT)
+		if err != nil {
+			t.Fatalf("ReadLine returned error: %s", err)
+		}
+		if line != want {
+			t.Errorf("wrong line. expected=%q, got=%q", want, line)
+		}
+	}
+}
+
+func TestLineEditorControlKeys(t *testing.T) {
+	e := newLineEditor(bufio.NewReader(strings.NewReader("abc\x03\x04")), ioutil.Discard)
+
+	if _, err := e.ReadLine(PROMPT); err != errInterrupted {
+		t.Errorf("Ctrl-C did not interrupt. got=%v", err)
+	}
+	if _, err := e.ReadLine(PROMPT); err != io.EOF {
+		t.Errorf("Ctrl-D on an empty line did not return EOF. got=%v", err)
+	}
+}
+
+func TestReadInputContinuation(t *testing.T) {
+	input := "let add = fn(a, b) {\n  a + b\n};\n[1,\n2]\n"
+	lines := &plainReader{in: bufio.NewReader(strings.NewReader(input)), out: ioutil.Discard}
+
+	expected := []string{"let add = fn(a, b) {\n  a + b\n};", "[1,\n2]"}
+	for _, want := range expected {
+		source, err := readInput(lines)
+		if err != nil {
+			t.Fatalf("readInput returned error: %s", err)
+		}
+		if source != want {
+			t.Errorf("wrong input. expected=%q, got=%q", want, source)
+		}
+	}
+}
+
+func TestNeedsContinuation(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected bool
+	}{
+		{"let x = 5;", false},
+		{"fn(x) {", true},
+		{"fn(x) { x }", false},
+		{"[1, 2", true},
+		{"add(1,", true},
+		{`"{"`, false},
+		{"}", false},
+	}
+
+	for _, tt := range tests {
+		if got := needsContinuation(tt.source); got != tt.expected {
+			t.Errorf("needsContinuation(%q) wrong. expected=%t, got=%t",
+				tt.source, tt.expected, got)
+		}
+	}
+}
@@ -2,67 +2,189 @@ package repl
 
 import (
 	"bufio"
-	"fmt"
 	"io"
+	"io/ioutil"
+	"monke/ast"
+	"monke/diagnostic"
 	"monke/evaluator"
 	"monke/lexer"
 	"monke/object"
 	"monke/parser"
+	"monke/resolver"
+	"monke/token"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
 const PROMPT = ">> "
 
+// shown instead of PROMPT while an unfinished expression is being typed
+const CONTINUATION_PROMPT = ".. "
+
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+	// the REPL and the `gets` builtin share one buffered reader so neither
+	// swallows input meant for the other
+	reader := bufio.NewReader(in)
+	s := newSession(reader, out)
+	lines := newLineReader(in, reader, out)
 
 	for {
-		fmt.Fprintf(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		input, err := readInput(lines)
+		if err == errInterrupted {
+			continue
+		}
+		if err != nil {
 			return
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
-
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+		if isCommand(input) {
+			if !s.runCommand(input) {
+				return
+			}
 			continue
 		}
 
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+		program, ok := s.parse(input)
+		if !ok {
+			continue
 		}
+
+		s.print(s.interpreter.Eval(program, s.env))
 	}
 }
 
-func Interpret(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+// uses the line editor if in and out are both terminals and falls back to
+// reading plain lines otherwise
+func newLineReader(in io.Reader, reader *bufio.Reader, out io.Writer) lineReader {
+	inFile, ok := in.(*os.File)
+	if !ok || !isTerminal(int(inFile.Fd())) {
+		return &plainReader{in: reader, out: out}
+	}
+	if outFile, ok := out.(*os.File); !ok || !isTerminal(int(outFile.Fd())) {
+		return &plainReader{in: reader, out: out}
+	}
+
+	editor := newLineEditor(reader, out)
+	editor.rawMode = func() (func(), error) {
+		return enableRawMode(int(inFile.Fd()))
+	}
+	if path := defaultHistoryFile(); path != "" {
+		editor.useHistoryFile(path)
+	}
+	return editor
+}
+
+// reads lines until the brackets, braces and parentheses in them are
+// balanced, so functions and hashes can be typed over several lines
+func readInput(lines lineReader) (string, error) {
+	input := []string{}
+	prompt := PROMPT
 
 	for {
-		scanned := scanner.Scan()
-		if !scanned {
-			return
+		line, err := lines.ReadLine(prompt)
+		if err == io.EOF && len(input) > 0 {
+			// let the parser report whatever is left unbalanced
+			return strings.Join(input, "\n"), nil
+		}
+		if err != nil {
+			return "", err
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
+		input = append(input, line)
+		source := strings.Join(input, "\n")
+		if !needsContinuation(source) {
+			return source, nil
+		}
 
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
-			return
+		prompt = CONTINUATION_PROMPT
+	}
+}
+
+// reports whether source has more opening than closing delimiters
+func needsContinuation(source string) bool {
+	depth := 0
+	l := lexer.New(source)
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Type == token.STRING {
+			continue
+		}
+
+		switch tok.Literal {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
 		}
+	}
+
+	return depth > 0
+}
+
+// InterpretFile runs the program in fileName, resolving its imports relative
+// to the directory the file lives in. What the program prints goes to out and
+// its errors to stderr.
+func InterpretFile(fileName string, out io.Writer) error {
+	return InterpretFileWith(evaluator.New(), fileName, out)
+}
+
+// InterpretFileWith is InterpretFile on an interpreter the caller has set up,
+// say to profile the program. Errors go to the interpreter's Stderr.
+func InterpretFileWith(interpreter *evaluator.Interpreter, fileName string, out io.Writer) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	interpreter.Dir = filepath.Dir(fileName)
+	interpreter.File = fileName
+	interpret(interpreter, fileName, file, out)
+	return nil
+}
+
+// Interpret runs the program read from in, writing what it prints and its
+// errors to out.
+func Interpret(in io.Reader, out io.Writer) {
+	interpreter := evaluator.New()
+	interpreter.Stderr = out
+	interpret(interpreter, "", in, out)
+}
+
+func interpret(interpreter *evaluator.Interpreter, fileName string, in io.Reader, out io.Writer) {
+	source, err := ioutil.ReadAll(in)
+	if err != nil {
+		io.WriteString(interpreter.Stderr, err.Error()+"\n")
+		return
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(interpreter.Stderr, fileName, string(source), p.Diagnostics())
+		return
+	}
+
+	env := object.NewEnvironment()
+	interpreter.Stdout = out
+
+	// statements run one at a time so their values are echoed like in the
+	// REPL, which means doing what evaluating the program as a whole would
+	// up front: laying out the slots of its functions and binding the
+	// functions declared anywhere in the file
+	resolver.AssignSlots(program)
+	for _, stmt := range program.Statements {
+		if decl, ok := stmt.(*ast.FunctionDeclaration); ok {
+			env.Set(decl.Function.Name.Value, interpreter.Eval(decl.Function, env))
+		}
+	}
 
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
+	for _, stmt := range program.Statements {
+		evaluated := interpreter.Eval(stmt, env)
+		if err, ok := evaluated.(*object.Error); ok {
+			io.WriteString(interpreter.Stderr, err.Inspect()+"\n")
+		} else if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
 		}
@@ -82,11 +204,11 @@ const MONKEY_FACE = `            __,__
            '-----'
 `
 
-func printParserErrors(out io.Writer, errors []string) {
+func printParserErrors(out io.Writer, fileName, source string, diagnostics []diagnostic.Diagnostic) {
 	io.WriteString(out, MONKEY_FACE)
 	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
 	io.WriteString(out, " parser errors:\n")
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+	for _, d := range diagnostics {
+		diagnostic.Render(out, fileName, source, d)
 	}
 }
@@ -0,0 +1,50 @@
+package repl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"monke/evaluator"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInterpretFileWith(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monke-repl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		source string
+		stdout string
+		stderr string
+	}{
+		{"puts(\"hi\");\n1 + true;\n2", "hi\nnull\n2\n", "ERROR: type mismatch: INTEGER + BOOLEAN\n"},
+		{"f(1);\nfn f(x) { x * 2 }", "2\n", ""},
+		{"let x = ;", "", "parser errors:"},
+	}
+
+	for _, tt := range tests {
+		file := filepath.Join(dir, "main.grr")
+		if err := ioutil.WriteFile(file, []byte(tt.source), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var stdout, stderr bytes.Buffer
+		in := evaluator.New()
+		in.Stderr = &stderr
+		if err := InterpretFileWith(in, file, &stdout); err != nil {
+			t.Fatalf("InterpretFileWith returned error: %s", err)
+		}
+
+		if stdout.String() != tt.stdout {
+			t.Errorf("%q: wrong output. expected=%q, got=%q", tt.source, tt.stdout, stdout.String())
+		}
+		if !strings.Contains(stderr.String(), tt.stderr) || tt.stderr == "" && stderr.Len() != 0 {
+			t.Errorf("%q: wrong errors. expected=%q, got=%q", tt.source, tt.stderr, stderr.String())
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package repl
+
+import "errors"
+
+// Raw mode is only implemented for Linux. Everywhere else the REPL falls back
+// to reading plain lines.
+func isTerminal(fd int) bool { return false }
+
+func enableRawMode(fd int) (func(), error) {
+	return nil, errors.New("raw mode not supported on this platform")
+}
@@ -0,0 +1,319 @@
+// Package resolver works out which binding every identifier in a program
+// refers to without running it, so mistakes like misspelled names are found
+// even in code that rarely runs.
+package resolver
+
+import (
+	"fmt"
+	"monke/ast"
+	"monke/diagnostic"
+	"monke/token"
+	"sort"
+	"strings"
+)
+
+// diagnostic codes
+const (
+	UNRESOLVED = "R001"
+	SHADOWED   = "R002"
+	UNUSED     = "R003"
+)
+
+// kinds of bindings
+const (
+	LET_BINDING   = "let"
+	PARAM_BINDING = "parameter"
+	CATCH_BINDING = "catch"
+	FUNC_BINDING  = "function"
+)
+
+// Binding is a name introduced by a let statement, a function declaration, a
+// function parameter or a catch clause.
+type Binding struct {
+	Kind  string
+	Name  *ast.Identifier
+	Value ast.Expression // only set for let bindings and function declarations
+	Scope *Scope
+	// the identifiers referring to the binding, not counting Name itself
+	Uses []*ast.Identifier
+}
+
+// Reference is an identifier and the binding it refers to. Binding is nil
+// for builtins and names that aren't bound anywhere. Declarations are
+// references to their own binding.
+type Reference struct {
+	Ident   *ast.Identifier
+	Binding *Binding
+}
+
+// Scope is the part of a program whose bindings share an environment when
+// it runs: the whole program, a function body or a catch block. Blocks of
+// ifs and trys don't get scopes of their own.
+type Scope struct {
+	Outer    *Scope
+	Node     ast.Node // the program, function literal or try expression
+	Bindings map[string]*Binding
+
+	// identifiers in the functions inside the scope that weren't bound yet
+	// when we got to them. Functions can run after bindings made later in
+	// the scopes around them, so these are resolved once the scope is
+	// complete.
+	pending []*ast.Identifier
+}
+
+// returns the binding name refers to in s or the scopes around it
+func (s *Scope) Lookup(name string) *Binding {
+	for ; s != nil; s = s.Outer {
+		if b, ok := s.Bindings[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// returns the innermost function scope s is in, or nil at the top level
+func (s *Scope) function() *Scope {
+	for ; s != nil; s = s.Outer {
+		if _, ok := s.Node.(*ast.FunctionLiteral); ok {
+			return s
+		}
+	}
+	return nil
+}
+
+// Result is everything the resolver found out about a program.
+type Result struct {
+	Bindings    []*Binding
+	References  []Reference
+	Scopes      []*Scope // the program's scope comes first
+	Diagnostics []diagnostic.Diagnostic
+
+	builtins map[string]bool
+}
+
+// Resolve resolves every identifier in program. Names in builtins are
+// defined everywhere without being bound in the program.
+func Resolve(program *ast.Program, builtins []string) *Result {
+	r := &Result{builtins: make(map[string]bool)}
+	for _, name := range builtins {
+		r.builtins[name] = true
+	}
+
+	global := r.newScope(nil, program)
+	r.hoist(program.Statements, global)
+	for _, stmt := range program.Statements {
+		r.walk(stmt, global)
+	}
+	r.finish(global)
+
+	r.checkShadowing()
+	r.checkUnused()
+
+	sort.SliceStable(r.Diagnostics, func(i, j int) bool {
+		return r.Diagnostics[i].Span.Start.Offset < r.Diagnostics[j].Span.Start.Offset
+	})
+
+	return r
+}
+
+// IsBuiltin reports whether name was one of the builtins given to Resolve.
+func (r *Result) IsBuiltin(name string) bool {
+	return r.builtins[name]
+}
+
+// ReferenceAt returns the reference at pos, if there is an identifier there.
+// pos may also be just after the identifier, where the cursor is when
+// typing it.
+func (r *Result) ReferenceAt(pos token.Position) (Reference, bool) {
+	for _, ref := range r.References {
+		tok := ref.Ident.Token
+		if tok.Pos.Line == pos.Line &&
+			tok.Pos.Column <= pos.Column && pos.Column <= tok.Pos.Column+len(tok.Literal) {
+			return ref, true
+		}
+	}
+	return Reference{}, false
+}
+
+func (r *Result) newScope(outer *Scope, node ast.Node) *Scope {
+	s := &Scope{Outer: outer, Node: node, Bindings: make(map[string]*Binding)}
+	r.Scopes = append(r.Scopes, s)
+	return s
+}
+
+func (r *Result) declare(s *Scope, kind string, name *ast.Identifier, value ast.Expression) {
+	b := &Binding{Kind: kind, Name: name, Value: value, Scope: s}
+	s.Bindings[name.Value] = b
+	r.Bindings = append(r.Bindings, b)
+	r.References = append(r.References, Reference{Ident: name, Binding: b})
+}
+
+func (r *Result) use(ident *ast.Identifier, b *Binding) {
+	if b != nil {
+		b.Uses = append(b.Uses, ident)
+	}
+	r.References = append(r.References, Reference{Ident: ident, Binding: b})
+}
+
+// resolves everything still pending in s against its final set of names and
+// hands the rest to the enclosing scope
+func (r *Result) finish(s *Scope) {
+	for _, ident := range s.pending {
+		if b, ok := s.Bindings[ident.Value]; ok {
+			r.use(ident, b)
+		} else if s.Outer != nil {
+			s.Outer.pending = append(s.Outer.pending, ident)
+		} else {
+			r.unresolved(ident)
+		}
+	}
+	s.pending = nil
+}
+
+func (r *Result) unresolved(ident *ast.Identifier) {
+	r.use(ident, nil)
+	if !r.builtins[ident.Value] {
+		r.report(diagnostic.ERROR, UNRESOLVED, ident, fmt.Sprintf("undefined: %s", ident.Value))
+	}
+}
+
+func (r *Result) walk(node ast.Node, s *Scope) {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		r.walk(node.Value, s)
+		r.declare(s, LET_BINDING, node.Name, node.Value)
+	case *ast.FunctionDeclaration:
+		// declared by hoist already
+		r.walk(node.Function, s)
+	case *ast.ReturnStatement:
+		r.walk(node.ReturnValue, s)
+	case *ast.ThrowStatement:
+		r.walk(node.Value, s)
+	case *ast.ExpressionStatement:
+		r.walk(node.Expression, s)
+	case *ast.BlockStatement:
+		r.hoist(node.Statements, s)
+		for _, stmt := range node.Statements {
+			r.walk(stmt, s)
+		}
+	case *ast.Identifier:
+		// code runs in order, so only the function the identifier is in
+		// can see bindings made after it, and only outside the function
+		if b := s.Lookup(node.Value); b != nil {
+			r.use(node, b)
+		} else if fn := s.function(); fn != nil {
+			fn.Outer.pending = append(fn.Outer.pending, node)
+		} else {
+			r.unresolved(node)
+		}
+	case *ast.PrefixExpression:
+		r.walk(node.Right, s)
+	case *ast.InfixExpression:
+		r.walk(node.Left, s)
+		r.walk(node.Right, s)
+	case *ast.IfExpression:
+		r.walk(node.Condition, s)
+		r.walk(node.Consequence, s)
+		if node.Alternative != nil {
+			r.walk(node.Alternative, s)
+		}
+	case *ast.FunctionLiteral:
+		fnScope := r.newScope(s, node)
+		for i, param := range node.Parameters {
+			// defaults are evaluated after the parameters before them are
+			// bound, but before anything else is
+			if value := node.Default(i); value != nil {
+				r.walk(value, fnScope)
+			}
+			r.declare(fnScope, PARAM_BINDING, param, nil)
+		}
+		if node.Rest != nil {
+			r.declare(fnScope, PARAM_BINDING, node.Rest, nil)
+		}
+		r.walk(node.Body, fnScope)
+		r.finish(fnScope)
+	case *ast.CallExpression:
+		r.walk(node.Function, s)
+		for _, arg := range node.Arguments {
+			r.walk(arg, s)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			r.walk(el, s)
+		}
+	case *ast.IndexExpression:
+		r.walk(node.Left, s)
+		r.walk(node.Index, s)
+	case *ast.HashLiteral:
+		for key, value := range node.Pairs {
+			r.walk(key, s)
+			r.walk(value, s)
+		}
+	case *ast.TryExpression:
+		r.walk(node.Block, s)
+		if node.Catch != nil {
+			catchScope := r.newScope(s, node)
+			r.declare(catchScope, CATCH_BINDING, node.CatchParam, nil)
+			r.walk(node.Catch, catchScope)
+			r.finish(catchScope)
+		}
+		if node.Finally != nil {
+			r.walk(node.Finally, s)
+		}
+	}
+}
+
+// declares the functions declared among stmts before anything else in them is
+// resolved, the way they are bound before the statements run
+func (r *Result) hoist(stmts []ast.Statement, s *Scope) {
+	for _, stmt := range stmts {
+		if decl, ok := stmt.(*ast.FunctionDeclaration); ok {
+			r.declare(s, FUNC_BINDING, decl.Function.Name, decl.Function)
+		}
+	}
+}
+
+// warns about bindings that hide one of the same name in an enclosing scope
+func (r *Result) checkShadowing() {
+	for _, b := range r.Bindings {
+		if b.Scope.Outer == nil {
+			continue
+		}
+
+		outer := b.Scope.Outer.Lookup(b.Name.Value)
+		if outer == nil {
+			continue
+		}
+
+		pos := outer.Name.Token.Pos
+		r.report(diagnostic.WARNING, SHADOWED, b.Name,
+			fmt.Sprintf("%s shadows the %s declared at %d:%d", b.Name.Value, outer.Kind, pos.Line, pos.Column),
+			"rename one of them if they aren't meant to be the same thing")
+	}
+}
+
+// warns about let bindings and declared functions nothing refers to.
+// Top-level bindings are left alone since another file may import them, as
+// are names starting with an underscore.
+func (r *Result) checkUnused() {
+	for _, b := range r.Bindings {
+		if (b.Kind != LET_BINDING && b.Kind != FUNC_BINDING) || b.Scope.Outer == nil || len(b.Uses) > 0 ||
+			strings.HasPrefix(b.Name.Value, "_") {
+			continue
+		}
+
+		r.report(diagnostic.WARNING, UNUSED, b.Name,
+			fmt.Sprintf("%s is declared but never used", b.Name.Value),
+			fmt.Sprintf("remove it or rename it to _%s", b.Name.Value))
+	}
+}
+
+func (r *Result) report(severity diagnostic.Severity, code string, ident *ast.Identifier, msg string, suggestions ...string) {
+	r.Diagnostics = append(r.Diagnostics, diagnostic.Diagnostic{
+		Severity:    severity,
+		Code:        code,
+		Message:     msg,
+		Span:        diagnostic.SpanOf(ident.Token),
+		Suggestions: suggestions,
+	})
+}
@@ -0,0 +1,138 @@
+package resolver
+
+import (
+	"monke/ast"
+	"monke/lexer"
+	"monke/parser"
+	"monke/token"
+	"testing"
+)
+
+var builtins = []string{"len", "puts", "push"}
+
+func resolve(t *testing.T, input string) (*ast.Program, *Result) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program, Resolve(program, builtins)
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; x + 1", nil},
+		{"puts(len([1]))", nil},
+		{"x", []string{"1:1: error[R001]: undefined: x"}},
+		{"if (false) { puts(mispelled) }", []string{"1:19: error[R001]: undefined: mispelled"}},
+		{"let f = fn() { g() }; let g = fn() { 1 }; f()", nil},
+		{"let f = fn(x) { x }; x", []string{"1:22: error[R001]: undefined: x"}},
+		{"try { 1 } catch (e) { e }; e", []string{"1:28: error[R001]: undefined: e"}},
+		{"if (true) { let y = 1 }; y", nil},
+		{"let x = 1; let f = fn(x) { x }; f(x)",
+			[]string{"1:23: warning[R002]: x shadows the let declared at 1:5"}},
+		{"let f = fn(a) { try { a } catch (a) { a } }; f(1)",
+			[]string{"1:34: warning[R002]: a shadows the parameter declared at 1:12"}},
+		{"let f = fn() { let unused = 1; 2 }; f()",
+			[]string{"1:20: warning[R003]: unused is declared but never used"}},
+		{"let f = fn() { let _ignored = 1; 2 }; f()", nil},
+		{"let notUsedAtTopLevel = 1;", nil},
+		{"let f = fn(a, b = a + 1, ...rest) { rest }; f(1)", nil},
+		{"let f = fn(a = b, b = 1) { a }; f()", []string{"1:16: error[R001]: undefined: b"}},
+		{"f(); fn f() { g() }; fn g() { 1 }", nil},
+		{"let g = 1; fn f() { g(); fn g() { 2 } }; f()", []string{
+			"1:29: warning[R002]: g shadows the let declared at 1:5",
+		}},
+		{"fn f() { fn helper() { 1 }; 2 }; f()",
+			[]string{"1:13: warning[R003]: helper is declared but never used"}},
+		{"let f = fn(a, b) { let c = d; a }; f(1, 2)", []string{
+			"1:24: warning[R003]: c is declared but never used",
+			"1:28: error[R001]: undefined: d",
+		}},
+		// used before they are bound
+		{"puts(x); let x = 1;", []string{"1:6: error[R001]: undefined: x"}},
+		{"let f = fn() { let y = z; let z = 1; y }; f()", []string{
+			"1:24: error[R001]: undefined: z",
+			"1:31: warning[R003]: z is declared but never used",
+		}},
+		{"try { throw 1 } catch (e) { puts(m); let m = e; m }", []string{"1:34: error[R001]: undefined: m"}},
+		{"let x = 1; let f = fn() { let y = x; let x = 2; y + x }; f()", []string{
+			"1:42: warning[R002]: x shadows the let declared at 1:5",
+		}},
+		{"let f = fn() { fn() { late } }; let late = 1; f()()", nil},
+	}
+
+	for _, tt := range tests {
+		_, r := resolve(t, tt.input)
+
+		if len(r.Diagnostics) != len(tt.expected) {
+			t.Errorf("wrong number of diagnostics for %q. expected=%d, got=%d %v",
+				tt.input, len(tt.expected), len(r.Diagnostics), r.Diagnostics)
+			continue
+		}
+
+		for i, d := range r.Diagnostics {
+			if d.String() != tt.expected[i] {
+				t.Errorf("wrong diagnostic for %q. expected=%q, got=%q", tt.input, tt.expected[i], d.String())
+			}
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	input := "let a = 1;\nlet f = fn(a) { a + later };\nlet later = a;\nlen(f)"
+	_, r := resolve(t, input)
+
+	tests := []struct {
+		pos      token.Position
+		name     string
+		kind     string
+		declLine int
+	}{
+		{token.Position{Line: 1, Column: 5}, "a", LET_BINDING, 1},
+		{token.Position{Line: 2, Column: 17}, "a", PARAM_BINDING, 2},
+		{token.Position{Line: 2, Column: 21}, "later", LET_BINDING, 3},
+		{token.Position{Line: 3, Column: 13}, "a", LET_BINDING, 1},
+		{token.Position{Line: 4, Column: 5}, "f", LET_BINDING, 2},
+	}
+
+	for _, tt := range tests {
+		ref, ok := r.ReferenceAt(tt.pos)
+		if !ok {
+			t.Errorf("no reference at %+v", tt.pos)
+			continue
+		}
+		if ref.Ident.Value != tt.name || ref.Binding == nil {
+			t.Errorf("wrong reference at %+v: %s bound to %v", tt.pos, ref.Ident.Value, ref.Binding)
+			continue
+		}
+		if ref.Binding.Kind != tt.kind || ref.Binding.Name.Token.Pos.Line != tt.declLine {
+			t.Errorf("%s at %+v bound to the %s on line %d, expected the %s on line %d", tt.name, tt.pos,
+				ref.Binding.Kind, ref.Binding.Name.Token.Pos.Line, tt.kind, tt.declLine)
+		}
+	}
+
+	ref, ok := r.ReferenceAt(token.Position{Line: 4, Column: 1})
+	if !ok || ref.Binding != nil || !r.IsBuiltin(ref.Ident.Value) {
+		t.Errorf("expected len to be an unbound builtin, got %+v", ref)
+	}
+}
+
+func TestUses(t *testing.T) {
+	_, r := resolve(t, "let x = 1; let f = fn() { x * x }; f()")
+
+	uses := map[string]int{}
+	for _, b := range r.Bindings {
+		uses[b.Name.Value] = len(b.Uses)
+	}
+
+	if uses["x"] != 2 || uses["f"] != 1 {
+		t.Errorf("wrong number of uses: %v", uses)
+	}
+	if len(r.Scopes) != 2 || r.Scopes[0].Outer != nil || r.Scopes[1].Outer != r.Scopes[0] {
+		t.Errorf("expected the program scope and one function scope inside it, got %d scopes", len(r.Scopes))
+	}
+}
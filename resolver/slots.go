@@ -0,0 +1,128 @@
+package resolver
+
+import "monke/ast"
+
+// AssignSlots lays out the environments of program's functions and catch
+// blocks as slots, one per name bound in them, and points every identifier
+// that refers to one of those bindings at its slot, so the evaluator can
+// find it by index rather than by name. Globals stay in named bindings,
+// since other files, the REPL and the debugger get at them by name.
+//
+// Unlike Resolve, an identifier is given the slot of the innermost scope
+// that binds its name anywhere, since that's the environment looking it up
+// by name would find it in once the binding is made. Until then the slot is
+// empty and the evaluator falls back to looking the name up. Running it
+// again on the same program gives the same result.
+func AssignSlots(program *ast.Program) {
+	assignSlots(program, nil)
+	program.Slotted = true
+}
+
+// slotScope is a function or catch block and the slots of its environment
+type slotScope struct {
+	outer *slotScope
+	names []string
+	index map[string]int
+}
+
+func newSlotScope(outer *slotScope) *slotScope {
+	return &slotScope{outer: outer, index: make(map[string]int)}
+}
+
+func (s *slotScope) add(name string) {
+	if _, ok := s.index[name]; !ok {
+		s.index[name] = len(s.names)
+		s.names = append(s.names, name)
+	}
+}
+
+// adds the names bound by node in the environment it runs in, leaving out
+// the ones bound by the functions and catch blocks inside it
+func (s *slotScope) collect(node ast.Node) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			s.add(node.Name.Value)
+		case *ast.FunctionDeclaration:
+			s.add(node.Function.Name.Value)
+			return false
+		case *ast.FunctionLiteral:
+			return false
+		case *ast.TryExpression:
+			s.collect(node.Block)
+			if node.Finally != nil {
+				s.collect(node.Finally)
+			}
+			return false
+		}
+		return true
+	})
+}
+
+// points ident at the slot of the innermost scope binding its name, if any
+// scope but the global one does
+func (s *slotScope) resolve(ident *ast.Identifier) {
+	ident.Slot = nil
+	for depth := 0; s != nil; depth, s = depth+1, s.outer {
+		if i, ok := s.index[ident.Value]; ok {
+			ident.Slot = &ast.Slot{Depth: depth, Index: i}
+			return
+		}
+	}
+}
+
+// assigns the slots of the identifiers in node, which runs in s, or at the
+// top level if s is nil
+func assignSlots(node ast.Node, s *slotScope) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			s.resolve(node)
+		case *ast.FunctionLiteral:
+			if node.Name != nil {
+				s.resolve(node.Name)
+			}
+
+			fnScope := newSlotScope(s)
+			for i, param := range node.Parameters {
+				fnScope.add(param.Value)
+				if value := node.Default(i); value != nil {
+					fnScope.collect(value)
+				}
+			}
+			if node.Rest != nil {
+				fnScope.add(node.Rest.Value)
+			}
+			fnScope.collect(node.Body)
+			node.Locals = fnScope.names
+
+			for i, param := range node.Parameters {
+				fnScope.resolve(param)
+				if value := node.Default(i); value != nil {
+					assignSlots(value, fnScope)
+				}
+			}
+			if node.Rest != nil {
+				fnScope.resolve(node.Rest)
+			}
+			assignSlots(node.Body, fnScope)
+			return false
+		case *ast.TryExpression:
+			assignSlots(node.Block, s)
+			if node.Catch != nil {
+				catchScope := newSlotScope(s)
+				catchScope.add(node.CatchParam.Value)
+				catchScope.collect(node.Catch)
+				node.CatchLocals = catchScope.names
+
+				catchScope.resolve(node.CatchParam)
+				assignSlots(node.Catch, catchScope)
+			}
+			if node.Finally != nil {
+				assignSlots(node.Finally, s)
+			}
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,73 @@
+package resolver
+
+import (
+	"fmt"
+	"monke/ast"
+	"monke/lexer"
+	"monke/parser"
+	"strings"
+	"testing"
+)
+
+func TestAssignSlots(t *testing.T) {
+	tests := []struct {
+		input string
+		// every identifier in order, with its depth and index if it has a slot
+		idents string
+		// the slots of each function and catch block in order
+		locals string
+	}{
+		{"let x = 1; x", "x x", ""},
+		{"let x = 1; let f = fn(a, b) { let c = a + b; c + x }",
+			"x f a@0.0 b@0.1 c@0.2 a@0.0 b@0.1 c@0.2 x", "[a b c]"},
+		{"fn outer(a) { fn(b) { a + b + len(b) } }",
+			"outer a@0.0 b@0.0 a@1.0 b@0.0 len b@0.0", "[a] [b]"},
+		// x is bound in the function after g is defined, but before g runs
+		{"let x = 1; fn(a) { let g = fn() { x }; let x = a; g() }",
+			"x a@0.0 g@0.1 x@1.2 x@0.2 a@0.0 g@0.1", "[a g x] []"},
+		{"fn(a) { try { a } catch (e) { let m = e; m + a } finally { let f = 1 } }",
+			"a@0.0 a@0.0 e@0.0 m@0.1 e@0.0 m@0.1 a@1.0 f@0.1", "[a f] [e m]"},
+		{"fn(a, b = if (a) { let t = 1; t }) { fn inner() { b } }",
+			"a@0.0 b@0.1 a@0.0 t@0.2 t@0.2 inner@0.3 b@1.1", "[a b t inner] []"},
+		{"fn(...rest) { let rest = 1; rest }", "rest@0.0 rest@0.0 rest@0.0", "[rest]"},
+		{"if (true) { let y = 1 }; fn() { y }", "y y", "[]"},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, p.Errors())
+		}
+
+		// assigning slots again must give the same ones
+		AssignSlots(program)
+		AssignSlots(program)
+
+		var idents, locals []string
+		ast.Inspect(program, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.Identifier:
+				if node.Slot != nil {
+					idents = append(idents, fmt.Sprintf("%s@%d.%d", node.Value, node.Slot.Depth, node.Slot.Index))
+				} else {
+					idents = append(idents, node.Value)
+				}
+			case *ast.FunctionLiteral:
+				locals = append(locals, fmt.Sprint(node.Locals))
+			case *ast.TryExpression:
+				if node.Catch != nil {
+					locals = append(locals, fmt.Sprint(node.CatchLocals))
+				}
+			}
+			return true
+		})
+
+		if got := strings.Join(idents, " "); got != tt.idents {
+			t.Errorf("%s - wrong slots.\nwant=%s\ngot= %s", tt.input, tt.idents, got)
+		}
+		if got := strings.Join(locals, " "); got != tt.locals {
+			t.Errorf("%s - wrong locals. want=%s, got=%s", tt.input, tt.locals, got)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monke/coverage"
+	"monke/evaluator"
+	"monke/pprof"
+	"monke/repl"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// runs a program, optionally recording what it spends its time on and which
+// of its code ran
+func runRun(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	profile := flags.String("profile", "", "write a pprof profile of the program to `file` and a report to stderr")
+	cover := flags.String("coverage", "", "write a coverage report of the program to `file`, or to stderr for -")
+	coverFormat := flags.String("coverage-format", "", "the `format` of the coverage report: text, html or lcov. By default it follows the extension of the file")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: monke run [-profile file] [-coverage file [-coverage-format format]] file.grr")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	fileName := flags.Arg(0)
+
+	format := *coverFormat
+	if format == "" {
+		format = coverageFormat(*cover)
+	}
+	if format != "text" && format != "html" && format != "lcov" {
+		fmt.Fprintf(os.Stderr, "unknown coverage format %q\n", format)
+		return 2
+	}
+
+	in := evaluator.New()
+	in.File = fileName
+	if *profile != "" {
+		in.StartProfile()
+	}
+	if *cover != "" {
+		in.StartCoverage()
+	}
+
+	if err := repl.InterpretFileWith(in, fileName, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *profile != "" {
+		p := in.StopProfile()
+		writeProfileReport(os.Stderr, p)
+		if err := writeProfile(*profile, p); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if *cover != "" {
+		if err := writeCoverage(*cover, format, fileName, in.StopCoverage()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// guesses the format of a coverage report from the name of its file
+func coverageFormat(fileName string) string {
+	switch filepath.Ext(fileName) {
+	case ".html", ".htm":
+		return "html"
+	case ".lcov", ".info":
+		return "lcov"
+	}
+	return "text"
+}
+
+// writes a report on which code of the program in fileName and the modules
+// it imported ran
+func writeCoverage(out, format, fileName string, c *evaluator.Coverage) error {
+	files, err := coverage.Build(c, []string{fileName})
+	if err != nil {
+		return err
+	}
+
+	write := coverage.WriteText
+	switch format {
+	case "html":
+		write = coverage.WriteHTML
+	case "lcov":
+		write = coverage.WriteLCOV
+	}
+
+	if out == "-" {
+		return write(os.Stderr, files)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := write(f, files); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeProfile(fileName string, p *evaluator.Profile) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	if err := pprof.Write(f, p); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// prints a table of the functions in p, the ones that took longest by
+// themselves first
+func writeProfileReport(w io.Writer, p *evaluator.Profile) {
+	functions := make([]*evaluator.FunctionProfile, len(p.Functions))
+	copy(functions, p.Functions)
+	sort.SliceStable(functions, func(i, j int) bool {
+		return functions[i].Exclusive > functions[j].Exclusive
+	})
+
+	fmt.Fprintf(w, "%10s %12s %12s %10s  %s\n", "calls", "inclusive", "exclusive", "allocs", "function")
+	for _, fn := range functions {
+		where := "builtin"
+		if !fn.Builtin {
+			where = fmt.Sprintf("%s:%d", fn.File, fn.Line)
+		}
+		fmt.Fprintf(w, "%10d %12s %12s %10d  %s (%s)\n", fn.Calls,
+			fn.Inclusive.Round(time.Microsecond), fn.Exclusive.Round(time.Microsecond),
+			fn.Allocations, fn.Name, where)
+	}
+	fmt.Fprintf(w, "total %s\n", p.Duration.Round(time.Microsecond))
+}
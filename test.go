@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"monke/tester"
+	"os"
+)
+
+// runs the tests in *_test.grr files and reports the results on stdout
+func runTest(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	format := flags.String("format", "text", "the `format` of the results: text, tap or junit")
+	verbose := flags.Bool("v", false, "list the tests that passed too, in the text format")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: monke test [-format text|tap|junit] [-v] [file.grr | directory]...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "text" && *format != "tap" && *format != "junit" {
+		flags.Usage()
+		return 2
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := tester.Discover(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "no test files")
+		return 0
+	}
+
+	status := 0
+	var results []*tester.Result
+	for _, fileName := range files {
+		fileResults, err := tester.RunFile(fileName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+		results = append(results, fileResults...)
+	}
+
+	switch *format {
+	case "tap":
+		err = tester.WriteTAP(os.Stdout, results)
+	case "junit":
+		err = tester.WriteJUnit(os.Stdout, results)
+	default:
+		err = tester.WriteText(os.Stdout, results, *verbose)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if _, failed := tester.Summary(results); failed > 0 {
+		status = 1
+	}
+	return status
+}
@@ -0,0 +1,162 @@
+package tester
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"monke/ast"
+	"monke/object"
+	"monke/token"
+	"runtime"
+	"time"
+)
+
+// the most calls a benchmark is timed over
+const MAX_CALLS = 1000000000
+
+// BenchmarkResult is what calling one benchmark function over and over cost.
+type BenchmarkResult struct {
+	File     string
+	Name     string
+	Pos      token.Position
+	N        int           // times the function was called
+	Duration time.Duration // of all the calls
+	// what the interpreter allocated during the calls
+	Allocs uint64
+	Bytes  uint64
+	// nil unless a call failed an assertion or ended in an error
+	Failure *Failure
+}
+
+// NsPerOp returns how long a call took on average.
+func (r *BenchmarkResult) NsPerOp() int64 {
+	if r.N == 0 {
+		return 0
+	}
+	return r.Duration.Nanoseconds() / int64(r.N)
+}
+
+// AllocsPerOp returns how many allocations a call made on average.
+func (r *BenchmarkResult) AllocsPerOp() int64 {
+	if r.N == 0 {
+		return 0
+	}
+	return int64(r.Allocs) / int64(r.N)
+}
+
+// BytesPerOp returns how many bytes a call allocated on average.
+func (r *BenchmarkResult) BytesPerOp() int64 {
+	if r.N == 0 {
+		return 0
+	}
+	return int64(r.Bytes) / int64(r.N)
+}
+
+// BenchFile runs the benchmarks in fileName. Each one is called with no
+// arguments, a growing number of times, until the calls take benchtime. The
+// top level of the file runs first in a fresh environment and isn't timed.
+// The error is for files that can't be read or parsed.
+func BenchFile(fileName string, benchtime time.Duration) ([]*BenchmarkResult, error) {
+	program, err := parseFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	r := newRunner(fileName)
+	// keeping track of statements would slow every call down, so failed
+	// assertions are reported at the benchmark
+	r.in.Hook = nil
+	r.in.Stdout, r.in.Stderr = ioutil.Discard, ioutil.Discard
+
+	var results []*BenchmarkResult
+	for _, bench := range Benchmarks(program) {
+		results = append(results, r.bench(program, bench, benchtime))
+	}
+	return results, nil
+}
+
+func (r *runner) bench(program *ast.Program, bench Test, benchtime time.Duration) *BenchmarkResult {
+	result := &BenchmarkResult{File: r.file, Name: bench.Name, Pos: bench.Pos}
+	at := location{r.file, bench.Pos}
+	r.in.File = r.file
+	r.failure = nil
+
+	env := object.NewEnvironment()
+	if err, ok := r.in.Eval(program, env).(*object.Error); ok {
+		r.fail(fmt.Sprintf("error at the top level: %s", err.Message), at)
+		result.Failure = r.failure
+		return result
+	}
+	fn, _ := env.Get(bench.Name)
+
+	for n := 1; ; n = nextN(n, result.Duration, benchtime) {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		for i := 0; i < n; i++ {
+			if err, ok := r.in.Call(fn).(*object.Error); ok {
+				r.fail(err.Message, at)
+				break
+			}
+		}
+		elapsed := time.Since(start)
+		runtime.ReadMemStats(&after)
+
+		if r.failure != nil {
+			result.Failure = r.failure
+			result.Failure.File, result.Failure.Pos = at.file, at.pos
+			return result
+		}
+
+		result.N, result.Duration = n, elapsed
+		result.Allocs = after.Mallocs - before.Mallocs
+		result.Bytes = after.TotalAlloc - before.TotalAlloc
+		if elapsed >= benchtime || n >= MAX_CALLS {
+			return result
+		}
+	}
+}
+
+// predicts how many calls take a little over benchtime from how long n calls
+// took, growing by at least one call and at most a hundredfold
+func nextN(n int, elapsed, benchtime time.Duration) int {
+	perCall := elapsed.Nanoseconds() / int64(n)
+	if perCall <= 0 {
+		perCall = 1
+	}
+	next := benchtime.Nanoseconds() / perCall * 6 / 5
+
+	if max := int64(n) * 100; next > max {
+		next = max
+	}
+	if next <= int64(n) {
+		next = int64(n) + 1
+	}
+	if next > MAX_CALLS {
+		next = MAX_CALLS
+	}
+	return int(next)
+}
+
+// WriteBenchmarks writes a line per benchmark with how many calls it was
+// timed over and what a call cost on average, in the style of `go test
+// -bench`. Failed benchmarks are reported with where and why they failed.
+func WriteBenchmarks(w io.Writer, results []*BenchmarkResult) error {
+	width := 0
+	for _, r := range results {
+		if len(r.Name) > width {
+			width = len(r.Name)
+		}
+	}
+
+	for _, r := range results {
+		if r.Failure != nil {
+			fmt.Fprintf(w, "--- FAIL: %s\n    %s: %s\n", r.Name, r.Failure.where(), r.Failure.Message)
+			continue
+		}
+		fmt.Fprintf(w, "%-*s %10d %12d ns/op %10d B/op %8d allocs/op\n",
+			width, r.Name, r.N, r.NsPerOp(), r.BytesPerOp(), r.AllocsPerOp())
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package tester
+
+import (
+	"bytes"
+	"monke/token"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBenchFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main_test.grr": `let lib = import "lib.grr";
+fn fib(n) { if (n < 2) { return n }; fib(n - 1) + fib(n - 2) }
+
+fn bench_fib() { puts(fib(10)) }
+let bench_lib = fn() { lib["double"](2) };
+fn bench_assert() {
+  assert_eq(fib(3), 3);
+}
+fn bench_error() { 1 + "a" }
+fn test_ignored() { assert(false) }
+`,
+		"lib.grr":         "let double = fn(x) { x * 2 };",
+		"broken_test.grr": "let x = 1 + \"a\";\nfn bench_x() {}",
+	})
+	main := filepath.Join(dir, "main_test.grr")
+
+	results, err := BenchFile(main, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("BenchFile returned error: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		message string // empty if the benchmark runs
+		line    int
+	}{
+		{"bench_fib", "", 4},
+		{"bench_lib", "", 5},
+		{"bench_assert", "got 2, want 3", 6},
+		{"bench_error", "type mismatch: INTEGER + STRING", 9},
+	}
+
+	if len(results) != len(tests) {
+		t.Fatalf("wrong number of results. want=%d, got=%d", len(tests), len(results))
+	}
+	for i, tt := range tests {
+		r := results[i]
+		if r.Name != tt.name || r.File != main || r.Pos.Line != tt.line {
+			t.Errorf("results[%d] - want %s at line %d, got %s at %s:%d", i, tt.name, tt.line, r.Name, r.File, r.Pos.Line)
+		}
+		if tt.message == "" {
+			if r.Failure != nil {
+				t.Errorf("%s failed: %+v", tt.name, r.Failure)
+			}
+			if r.N == 0 || r.Duration < 10*time.Millisecond || r.NsPerOp() <= 0 {
+				t.Errorf("%s wasn't timed long enough: %d calls in %s", tt.name, r.N, r.Duration)
+			}
+			continue
+		}
+		if r.Failure == nil {
+			t.Errorf("%s didn't fail", tt.name)
+			continue
+		}
+		if r.Failure.Message != tt.message || r.Failure.File != main || r.Failure.Pos.Line != tt.line {
+			t.Errorf("%s - want %q at line %d, got %q at %s:%d", tt.name, tt.message, tt.line,
+				r.Failure.Message, r.Failure.File, r.Failure.Pos.Line)
+		}
+	}
+
+	results, err = BenchFile(filepath.Join(dir, "broken_test.grr"), time.Millisecond)
+	if err != nil {
+		t.Fatalf("BenchFile returned error: %s", err)
+	}
+	expected := "error at the top level: type mismatch: INTEGER + STRING"
+	if len(results) != 1 || results[0].Failure == nil || results[0].Failure.Message != expected {
+		t.Errorf("expected bench_x to fail with %q, got %+v", expected, results)
+	}
+}
+
+func TestNextN(t *testing.T) {
+	tests := []struct {
+		n         int
+		elapsed   time.Duration
+		benchtime time.Duration
+		expected  int
+	}{
+		{1, time.Millisecond, time.Second, 100},
+		{100, 100 * time.Millisecond, time.Second, 1200},
+		{1000, 900 * time.Millisecond, time.Second, 1333},
+		{10, 0, time.Second, 1000},
+		{5, time.Second, time.Millisecond, 6},
+		{MAX_CALLS / 2, time.Nanosecond, time.Second, MAX_CALLS},
+	}
+
+	for _, tt := range tests {
+		if got := nextN(tt.n, tt.elapsed, tt.benchtime); got != tt.expected {
+			t.Errorf("nextN(%d, %s, %s) - want=%d, got=%d", tt.n, tt.elapsed, tt.benchtime, tt.expected, got)
+		}
+	}
+}
+
+func TestWriteBenchmarks(t *testing.T) {
+	results := []*BenchmarkResult{
+		{Name: "bench_fib", N: 100, Duration: 250 * time.Millisecond, Allocs: 1500, Bytes: 64000},
+		{Name: "bench_x", N: 2000000, Duration: time.Second, Allocs: 0, Bytes: 0},
+		{Name: "bench_broken", Failure: &Failure{Message: "got 2, want 3", File: "a_test.grr", Pos: token.Position{Line: 5, Column: 1}}},
+	}
+
+	var out bytes.Buffer
+	if err := WriteBenchmarks(&out, results); err != nil {
+		t.Fatalf("WriteBenchmarks returned error: %s", err)
+	}
+
+	expected := `bench_fib           100      2500000 ns/op        640 B/op       15 allocs/op
+bench_x         2000000          500 ns/op          0 B/op        0 allocs/op
+--- FAIL: bench_broken
+    a_test.grr:5:1: got 2, want 3
+`
+	if out.String() != expected {
+		t.Errorf("wrong output. want=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
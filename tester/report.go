@@ -0,0 +1,160 @@
+package tester
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Summary counts the results that passed and failed.
+func Summary(results []*Result) (passed, failed int) {
+	for _, r := range results {
+		if r.Passed() {
+			passed++
+		} else {
+			failed++
+		}
+	}
+	return passed, failed
+}
+
+// where a failure happened, as file:line:column
+func (f *Failure) where() string {
+	return fmt.Sprintf("%s:%d:%d", f.File, f.Pos.Line, f.Pos.Column)
+}
+
+// WriteText writes the failed tests with where and why they failed and what
+// they printed, then a summary. With verbose, passed tests are listed too.
+func WriteText(w io.Writer, results []*Result, verbose bool) error {
+	for _, r := range results {
+		if r.Passed() {
+			if verbose {
+				fmt.Fprintf(w, "--- PASS: %s (%s)\n", r.Name, seconds(r.Duration))
+			}
+			continue
+		}
+
+		fmt.Fprintf(w, "--- FAIL: %s (%s)\n", r.Name, seconds(r.Duration))
+		fmt.Fprintf(w, "    %s: %s\n", r.Failure.where(), r.Failure.Message)
+		for _, line := range lines(r.Output) {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+	}
+
+	passed, failed := Summary(results)
+	status := "PASS"
+	if failed > 0 {
+		status = "FAIL"
+	}
+	_, err := fmt.Fprintf(w, "%s: %d passed, %d failed\n", status, passed, failed)
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.2fs", d.Seconds())
+}
+
+// splits output into lines, leaving out the empty one after the last newline
+func lines(output string) []string {
+	if output == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+}
+
+// WriteTAP writes the results in the Test Anything Protocol, version 13.
+// Failures come with a YAML block and output as comments.
+func WriteTAP(w io.Writer, results []*Result) error {
+	fmt.Fprintf(w, "TAP version 13\n1..%d\n", len(results))
+	for i, r := range results {
+		status := "ok"
+		if !r.Passed() {
+			status = "not ok"
+		}
+		fmt.Fprintf(w, "%s %d - %s: %s\n", status, i+1, r.File, r.Name)
+		if !r.Passed() {
+			fmt.Fprintf(w, "  ---\n  message: %q\n  at: %q\n  ...\n", r.Failure.Message, r.Failure.where())
+		}
+		for _, line := range lines(r.Output) {
+			fmt.Fprintf(w, "# %s\n", line)
+		}
+	}
+	return nil
+}
+
+// the JUnit XML format, as CI services read it
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the results as JUnit XML with a test suite per file.
+func WriteJUnit(w io.Writer, results []*Result) error {
+	var suites junitSuites
+	for _, r := range results {
+		if len(suites.Suites) == 0 || suites.Suites[len(suites.Suites)-1].Name != r.File {
+			suites.Suites = append(suites.Suites, junitSuite{Name: r.File})
+		}
+		suite := &suites.Suites[len(suites.Suites)-1]
+
+		c := junitCase{
+			Name:      r.Name,
+			ClassName: r.File,
+			Time:      fmt.Sprintf("%.3f", r.Duration.Seconds()),
+			SystemOut: r.Output,
+		}
+		if !r.Passed() {
+			suite.Failures++
+			c.Failure = &junitFailure{
+				Message: r.Failure.Message,
+				Text:    r.Failure.where() + ": " + r.Failure.Message,
+			}
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	for i := range suites.Suites {
+		var total time.Duration
+		for _, r := range results {
+			if r.File == suites.Suites[i].Name {
+				total += r.Duration
+			}
+		}
+		suites.Suites[i].Time = fmt.Sprintf("%.3f", total.Seconds())
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,106 @@
+package tester
+
+import (
+	"bytes"
+	"monke/token"
+	"testing"
+	"time"
+)
+
+func testResults() []*Result {
+	return []*Result{
+		{File: "a_test.grr", Name: "test_one", Duration: 10 * time.Millisecond},
+		{File: "a_test.grr", Name: "test_two", Duration: 20 * time.Millisecond, Output: "hi\nthere\n",
+			Failure: &Failure{Message: `got 1, want "1"`, File: "a_test.grr", Pos: token.Position{Line: 3, Column: 5}}},
+		{File: "b_test.grr", Name: "test_three", Duration: 1500 * time.Millisecond},
+	}
+}
+
+func TestSummary(t *testing.T) {
+	passed, failed := Summary(testResults())
+	if passed != 2 || failed != 1 {
+		t.Errorf("wrong summary. passed=%d failed=%d", passed, failed)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	tests := []struct {
+		results  []*Result
+		verbose  bool
+		expected string
+	}{
+		{testResults(), false, `--- FAIL: test_two (0.02s)
+    a_test.grr:3:5: got 1, want "1"
+    hi
+    there
+FAIL: 2 passed, 1 failed
+`},
+		{testResults(), true, `--- PASS: test_one (0.01s)
+--- FAIL: test_two (0.02s)
+    a_test.grr:3:5: got 1, want "1"
+    hi
+    there
+--- PASS: test_three (1.50s)
+FAIL: 2 passed, 1 failed
+`},
+		{testResults()[:1], false, "PASS: 1 passed, 0 failed\n"},
+	}
+
+	for i, tt := range tests {
+		var out bytes.Buffer
+		if err := WriteText(&out, tt.results, tt.verbose); err != nil {
+			t.Fatalf("tests[%d] - WriteText returned error: %s", i, err)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("tests[%d] - wrong output. want=\n%s\ngot=\n%s", i, tt.expected, out.String())
+		}
+	}
+}
+
+func TestWriteTAP(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteTAP(&out, testResults()); err != nil {
+		t.Fatalf("WriteTAP returned error: %s", err)
+	}
+
+	expected := `TAP version 13
+1..3
+ok 1 - a_test.grr: test_one
+not ok 2 - a_test.grr: test_two
+  ---
+  message: "got 1, want \"1\""
+  at: "a_test.grr:3:5"
+  ...
+# hi
+# there
+ok 3 - b_test.grr: test_three
+`
+	if out.String() != expected {
+		t.Errorf("wrong output. want=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteJUnit(&out, testResults()); err != nil {
+		t.Fatalf("WriteJUnit returned error: %s", err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="a_test.grr" tests="2" failures="1" time="0.030">
+    <testcase name="test_one" classname="a_test.grr" time="0.010"></testcase>
+    <testcase name="test_two" classname="a_test.grr" time="0.020">
+      <failure message="got 1, want &#34;1&#34;">a_test.grr:3:5: got 1, want &#34;1&#34;</failure>
+      <system-out>hi&#xA;there&#xA;</system-out>
+    </testcase>
+  </testsuite>
+  <testsuite name="b_test.grr" tests="1" failures="0" time="1.500">
+    <testcase name="test_three" classname="b_test.grr" time="1.500"></testcase>
+  </testsuite>
+</testsuites>
+`
+	if out.String() != expected {
+		t.Errorf("wrong output. want=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
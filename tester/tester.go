@@ -0,0 +1,383 @@
+// Package tester runs the tests in Monke test files: the functions whose
+// names start with "test" in files whose names end in "_test.grr". Tests use
+// the assert, assert_eq and assert_error builtins to check their results.
+package tester
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"monke/ast"
+	"monke/evaluator"
+	"monke/lexer"
+	"monke/object"
+	"monke/parser"
+	"monke/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	FILE_SUFFIX  = "_test.grr"
+	TEST_PREFIX  = "test"
+	BENCH_PREFIX = "bench"
+)
+
+// the kind of the errors failed assertions raise
+const ASSERTION_ERROR = "AssertionError"
+
+// Result is the outcome of one test.
+type Result struct {
+	File     string
+	Name     string
+	Pos      token.Position // where the test function is defined
+	Failure  *Failure       // nil if the test passed
+	Output   string         // what the test printed
+	Duration time.Duration
+}
+
+// Passed reports whether the test passed.
+func (r *Result) Passed() bool {
+	return r.Failure == nil
+}
+
+// Failure is why a test failed: the first assertion that failed, or the
+// error that ended it. Errors other than failed assertions are reported at
+// the test function.
+type Failure struct {
+	Message string
+	File    string
+	Pos     token.Position
+}
+
+// Discover returns the test files in paths, sorted. Directories are searched
+// recursively for files ending in FILE_SUFFIX, and files are taken as given.
+func Discover(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.Walk(path, func(name string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.HasSuffix(name, FILE_SUFFIX) {
+				files = append(files, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Test is a test or benchmark function.
+type Test struct {
+	Name string
+	Pos  token.Position
+}
+
+// Tests returns the test functions declared at the top level of program,
+// with `fn` or `let`, in the order they appear.
+func Tests(program *ast.Program) []Test {
+	return functions(program, TEST_PREFIX)
+}
+
+// Benchmarks returns the benchmark functions declared at the top level of
+// program, the ones whose names start with BENCH_PREFIX.
+func Benchmarks(program *ast.Program) []Test {
+	return functions(program, BENCH_PREFIX)
+}
+
+// returns the functions declared at the top level of program whose names
+// start with prefix
+func functions(program *ast.Program, prefix string) []Test {
+	var tests []Test
+	for _, stmt := range program.Statements {
+		switch stmt := stmt.(type) {
+		case *ast.FunctionDeclaration:
+			if strings.HasPrefix(stmt.Function.Name.Value, prefix) {
+				tests = append(tests, Test{Name: stmt.Function.Name.Value, Pos: stmt.Token.Pos})
+			}
+		case *ast.LetStatement:
+			if _, ok := stmt.Value.(*ast.FunctionLiteral); ok && strings.HasPrefix(stmt.Name.Value, prefix) {
+				tests = append(tests, Test{Name: stmt.Name.Value, Pos: stmt.Token.Pos})
+			}
+		}
+	}
+	return tests
+}
+
+// reads and parses fileName, failing on the first syntax error
+func parseFile(fileName string) (*ast.Program, error) {
+	source, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if diagnostics := p.Diagnostics(); len(diagnostics) != 0 {
+		d := diagnostics[0]
+		return nil, fmt.Errorf("%s:%d:%d: %s", fileName, d.Span.Start.Line, d.Span.Start.Column, d.Message)
+	}
+	return program, nil
+}
+
+// RunFile runs the tests in fileName. Each test gets a fresh environment that
+// the top level of the file runs in first, so tests don't see each other's
+// bindings. The error is for files that can't be read or parsed.
+func RunFile(fileName string) ([]*Result, error) {
+	program, err := parseFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	r := newRunner(fileName)
+	var results []*Result
+	for _, test := range Tests(program) {
+		results = append(results, r.run(program, test))
+	}
+	return results, nil
+}
+
+// location is a position in a file
+type location struct {
+	file string
+	pos  token.Position
+}
+
+// runner runs the tests of one file with one interpreter, which keeps the
+// modules the tests import loaded between them
+type runner struct {
+	in   *evaluator.Interpreter
+	file string
+	// the statement running at each depth of calls, for the positions of
+	// failed assertions
+	where   []location
+	failure *Failure
+}
+
+func newRunner(fileName string) *runner {
+	r := &runner{in: evaluator.New(), file: fileName}
+	r.in.Dir = filepath.Dir(fileName)
+	r.in.Stdin = strings.NewReader("")
+	r.in.Hook = r.hook
+	r.in.Register("assert", evaluator.VARIADIC, r.assert)
+	r.in.Register("assert_eq", evaluator.VARIADIC, r.assertEq)
+	r.in.Register("assert_error", evaluator.VARIADIC, r.assertError)
+	return r
+}
+
+func (r *runner) run(program *ast.Program, test Test) *Result {
+	result := &Result{File: r.file, Name: test.Name, Pos: test.Pos}
+
+	var out bytes.Buffer
+	r.in.Stdout, r.in.Stderr = &out, &out
+	r.in.File = r.file
+	r.where, r.failure = nil, nil
+	start := time.Now()
+
+	env := object.NewEnvironment()
+	evaluated := r.in.Eval(program, env)
+	if err, ok := evaluated.(*object.Error); ok {
+		r.fail(fmt.Sprintf("error at the top level: %s", err.Message), location{r.file, test.Pos})
+	} else if fn, ok := env.Get(test.Name); ok {
+		if err, ok := r.in.Call(fn).(*object.Error); ok {
+			r.fail(err.Message, location{r.file, test.Pos})
+		}
+	}
+
+	result.Duration = time.Since(start)
+	result.Output = out.String()
+	result.Failure = r.failure
+	return result
+}
+
+// records a failure unless the test already failed
+func (r *runner) fail(message string, at location) {
+	if r.failure == nil {
+		r.failure = &Failure{Message: message, File: at.file, Pos: at.pos}
+	}
+}
+
+// keeps track of the statement running at the current depth
+func (r *runner) hook(node ast.Node, env *object.Environment) {
+	var pos token.Position
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		pos = node.Token.Pos
+	case *ast.ReturnStatement:
+		pos = node.Token.Pos
+	case *ast.ThrowStatement:
+		pos = node.Token.Pos
+	case *ast.ExpressionStatement:
+		pos = node.Token.Pos
+	default:
+		return
+	}
+
+	depth := r.in.Depth()
+	if depth < len(r.where) {
+		r.where = r.where[:depth]
+	}
+	// functions with empty bodies leave their depth without a statement
+	for len(r.where) < depth {
+		r.where = append(r.where, location{})
+	}
+	r.where = append(r.where, location{r.in.File, pos})
+}
+
+// fails the test at the statement that called the assertion and returns an
+// error to end it
+func (r *runner) assertionFailed(format string, a ...interface{}) object.Object {
+	message := fmt.Sprintf(format, a...)
+	var at location
+	if depth := r.in.Depth(); depth < len(r.where) {
+		at = r.where[depth]
+	}
+	r.fail(message, at)
+	err := evaluator.Errorf("%s", message)
+	err.Kind = ASSERTION_ERROR
+	return err
+}
+
+// the message passed as args[i], if any, followed by a colon
+func messageArg(fn string, args []object.Object, i int) (string, *object.Error) {
+	if len(args) <= i {
+		return "", nil
+	}
+	message, err := evaluator.StringArg(fn, args, i)
+	if err != nil {
+		return "", err
+	}
+	return message.Value + ": ", nil
+}
+
+func checkArgs(args []object.Object, min, max int) *object.Error {
+	if len(args) < min || len(args) > max {
+		err := evaluator.Errorf("wrong number of arguments. got=%d, want=%d..%d", len(args), min, max)
+		err.Kind = object.ARGUMENT_ERROR
+		return err
+	}
+	return nil
+}
+
+// assert(condition, message = "") fails the test unless condition is truthy
+func (r *runner) assert(args ...object.Object) object.Object {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return err
+	}
+	message, err := messageArg("assert", args, 1)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case evaluator.FALSE, evaluator.NULL:
+		return r.assertionFailed("%sassertion failed", message)
+	}
+	return evaluator.NULL
+}
+
+// assert_eq(got, want, message = "") fails the test unless got equals want.
+// Arrays and hashes are compared by their contents.
+func (r *runner) assertEq(args ...object.Object) object.Object {
+	if err := checkArgs(args, 2, 3); err != nil {
+		return err
+	}
+	message, err := messageArg("assert_eq", args, 2)
+	if err != nil {
+		return err
+	}
+
+	if !Equal(args[0], args[1]) {
+		return r.assertionFailed("%sgot %s, want %s", message, args[0].Inspect(), args[1].Inspect())
+	}
+	return evaluator.NULL
+}
+
+// assert_error(fn, contains = "") calls fn and fails the test unless it
+// raises or throws an error whose message contains the given text. It
+// returns the message.
+func (r *runner) assertError(args ...object.Object) object.Object {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return err
+	}
+	var contains string
+	if len(args) == 2 {
+		s, err := evaluator.StringArg("assert_error", args, 1)
+		if err != nil {
+			return err
+		}
+		contains = s.Value
+	}
+
+	result := r.in.Call(args[0])
+	err, ok := result.(*object.Error)
+	switch {
+	case !ok:
+		return r.assertionFailed("expected an error, got %s", inspect(result))
+	case !strings.Contains(err.Message, contains):
+		return r.assertionFailed("expected an error containing %q, got %q", contains, err.Message)
+	}
+	return &object.String{Value: err.Message}
+}
+
+// calls to functions that return nothing evaluate to nil
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "null"
+	}
+	return obj.Inspect()
+}
+
+// Equal reports whether a and b are the same value: equal integers, strings
+// or booleans, arrays and hashes with equal contents, or the same object.
+func Equal(a, b object.Object) bool {
+	switch a := a.(type) {
+	case *object.Integer:
+		b, ok := b.(*object.Integer)
+		return ok && a.Value == b.Value
+	case *object.String:
+		b, ok := b.(*object.String)
+		return ok && a.Value == b.Value
+	case *object.Array:
+		b, ok := b.(*object.Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !Equal(a.Elements[i], b.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		b, ok := b.(*object.Hash)
+		if !ok || len(a.Pairs) != len(b.Pairs) {
+			return false
+		}
+		for key, pair := range a.Pairs {
+			other, ok := b.Pairs[key]
+			if !ok || !Equal(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
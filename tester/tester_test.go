@@ -0,0 +1,257 @@
+package tester
+
+import (
+	"io/ioutil"
+	"monke/lexer"
+	"monke/object"
+	"monke/parser"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writes files, named relative to a new directory, and returns the directory
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "tester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestDiscover(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a_test.grr":          "",
+		"a.grr":               "",
+		"lib/b_test.grr":      "",
+		"lib/deep/c_test.grr": "",
+		"lib/c.grr":           "",
+	})
+
+	files, err := Discover([]string{dir, filepath.Join(dir, "a.grr")})
+	if err != nil {
+		t.Fatalf("Discover returned error: %s", err)
+	}
+
+	expected := []string{"a.grr", "a_test.grr", "lib/b_test.grr", "lib/deep/c_test.grr"}
+	if len(files) != len(expected) {
+		t.Fatalf("wrong files. want=%q, got=%q", expected, files)
+	}
+	for i, name := range expected {
+		if files[i] != filepath.Join(dir, name) {
+			t.Errorf("files[%d] - want=%q, got=%q", i, filepath.Join(dir, name), files[i])
+		}
+	}
+
+	if _, err := Discover([]string{filepath.Join(dir, "missing")}); err == nil {
+		t.Errorf("expected an error for a missing path")
+	}
+}
+
+func TestTests(t *testing.T) {
+	program := parser.New(lexer.New(`
+fn test_one() {}
+fn helper() {}
+let test_two = fn() {};
+let test_value = 1;
+fn tester() {}
+`)).ParseProgram()
+
+	tests := Tests(program)
+	expected := []string{"test_one", "test_two", "tester"}
+	if len(tests) != len(expected) {
+		t.Fatalf("wrong tests. want=%q, got=%+v", expected, tests)
+	}
+	for i, name := range expected {
+		if tests[i].Name != name {
+			t.Errorf("tests[%d] - want=%q, got=%q", i, name, tests[i].Name)
+		}
+	}
+	if tests[1].Pos.Line != 4 {
+		t.Errorf("test_two is on line 4, got %d", tests[1].Pos.Line)
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"lib.grr": `let check = fn(x) { assert(x > 0, "positive") };
+let double = fn(x) { x * 2 };`,
+		"main_test.grr": `let lib = import "lib.grr";
+let count = 0;
+
+fn test_passes() {
+  assert(true);
+  assert_eq(lib["double"](2), 4);
+  assert_eq([1, {"a": [2]}], [1, {"a": [2]}]);
+  let message = assert_error(fn() { throw "boom" }, "oo");
+  assert_eq(message, "boom");
+}
+
+fn test_assert() {
+  puts("before");
+  assert(1 > 2, "order");
+  puts("after");
+}
+
+fn test_assert_eq() {
+  let count = count + 1;
+  assert_eq(count, 2);
+}
+
+fn test_fresh_environment() {
+  let count = count + 1;
+  assert_eq(count, 1);
+}
+
+fn test_helper() {
+  lib["check"](-1);
+}
+
+fn test_assert_error() {
+  assert_error(fn() { 1 });
+}
+
+fn test_wrong_error() {
+  assert_error(fn() { 1 + "a" }, "boom");
+}
+
+fn test_error() {
+  1 + "a";
+}
+
+fn test_caught_assertion() {
+  try { assert(false) } catch (e) {}
+}
+
+fn test_bad_arguments() {
+  assert();
+}
+`,
+	})
+
+	results, err := RunFile(filepath.Join(dir, "main_test.grr"))
+	if err != nil {
+		t.Fatalf("RunFile returned error: %s", err)
+	}
+
+	main := filepath.Join(dir, "main_test.grr")
+	lib := filepath.Join(dir, "lib.grr")
+	tests := []struct {
+		name    string
+		message string // empty if the test passes
+		file    string
+		line    int
+		output  string
+	}{
+		{"test_passes", "", "", 0, ""},
+		{"test_assert", "order: assertion failed", main, 14, "before\n"},
+		{"test_assert_eq", "got 1, want 2", main, 20, ""},
+		{"test_fresh_environment", "", "", 0, ""},
+		{"test_helper", "positive: assertion failed", lib, 1, ""},
+		{"test_assert_error", "expected an error, got 1", main, 33, ""},
+		{"test_wrong_error", `expected an error containing "boom", got "type mismatch: INTEGER + STRING"`, main, 37, ""},
+		{"test_error", "type mismatch: INTEGER + STRING", main, 40, ""},
+		{"test_caught_assertion", "assertion failed", main, 45, ""},
+		{"test_bad_arguments", "wrong number of arguments. got=0, want=1..2", main, 48, ""},
+	}
+
+	if len(results) != len(tests) {
+		t.Fatalf("wrong number of results. want=%d, got=%d", len(tests), len(results))
+	}
+	for i, tt := range tests {
+		r := results[i]
+		if r.Name != tt.name || r.File != main {
+			t.Errorf("results[%d] - want %s in %s, got %s in %s", i, tt.name, main, r.Name, r.File)
+		}
+		if r.Output != tt.output {
+			t.Errorf("%s printed %q, want %q", tt.name, r.Output, tt.output)
+		}
+		if tt.message == "" {
+			if !r.Passed() {
+				t.Errorf("%s failed: %+v", tt.name, r.Failure)
+			}
+			continue
+		}
+		if r.Passed() {
+			t.Errorf("%s passed", tt.name)
+			continue
+		}
+		if r.Failure.Message != tt.message || r.Failure.File != tt.file || r.Failure.Pos.Line != tt.line {
+			t.Errorf("%s - want %q at %s:%d, got %q at %s:%d", tt.name, tt.message, tt.file, tt.line,
+				r.Failure.Message, r.Failure.File, r.Failure.Pos.Line)
+		}
+	}
+}
+
+func TestRunFileErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"syntax_test.grr": "let = 1;",
+		"top_test.grr":    "let x = 1 + \"a\";\nfn test_x() {}",
+	})
+
+	if _, err := RunFile(filepath.Join(dir, "syntax_test.grr")); err == nil {
+		t.Errorf("expected an error for a file that doesn't parse")
+	}
+	if _, err := RunFile(filepath.Join(dir, "missing_test.grr")); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+
+	results, err := RunFile(filepath.Join(dir, "top_test.grr"))
+	if err != nil {
+		t.Fatalf("RunFile returned error: %s", err)
+	}
+	if len(results) != 1 || results[0].Passed() {
+		t.Fatalf("expected test_x to fail, got %+v", results)
+	}
+	expected := "error at the top level: type mismatch: INTEGER + STRING"
+	if results[0].Failure.Message != expected || results[0].Failure.Pos.Line != 2 {
+		t.Errorf("wrong failure. want %q at line 2, got %+v", expected, results[0].Failure)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	hash := func(value object.Object) *object.Hash {
+		key := &object.String{Value: "k"}
+		return &object.Hash{Pairs: map[object.HashKey]object.HashPair{
+			key.HashKey(): {Key: key, Value: value},
+		}}
+	}
+	fn := &object.Function{}
+
+	tests := []struct {
+		a, b     object.Object
+		expected bool
+	}{
+		{&object.Integer{Value: 1}, &object.Integer{Value: 1}, true},
+		{&object.Integer{Value: 1}, &object.Integer{Value: 2}, false},
+		{&object.Integer{Value: 1}, &object.String{Value: "1"}, false},
+		{&object.String{Value: "a"}, &object.String{Value: "a"}, true},
+		{&object.Array{Elements: []object.Object{&object.Integer{Value: 1}}},
+			&object.Array{Elements: []object.Object{&object.Integer{Value: 1}}}, true},
+		{&object.Array{Elements: []object.Object{&object.Integer{Value: 1}}},
+			&object.Array{}, false},
+		{hash(&object.Integer{Value: 1}), hash(&object.Integer{Value: 1}), true},
+		{hash(&object.Integer{Value: 1}), hash(&object.Integer{Value: 2}), false},
+		{hash(&object.Integer{Value: 1}), &object.Hash{}, false},
+		{fn, fn, true},
+		{fn, &object.Function{}, false},
+	}
+
+	for i, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.expected {
+			t.Errorf("tests[%d] - Equal(%s, %s) = %t, want %t", i, tt.a.Inspect(), tt.b.Inspect(), got, tt.expected)
+		}
+	}
+}
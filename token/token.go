@@ -3,12 +3,22 @@ type TokenType string
 type Token struct {
     Type TokenType
     Literal string
+    Pos Position // where the token starts in the source
+}
+
+// Position is a location in the source. Offset counts bytes from the start,
+// Line and Column start at 1.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
 }
 
 //defining token types
 const (
     ILLEGAL = "ILLEGAL"
     EOF = "EOF"
+	COMMENT = "COMMENT" // never returned by the lexer, see lexer.Comments
 
     //  Identifiers and literals
     IDENT = "IDENT"
@@ -31,11 +41,12 @@ const (
     COMMA = ","
     SEMICOLON = ";"
 	COLON = ":"
+	ELLIPSIS = "..."
 
     LPAREN = "("
     RPAREN = ")"
     LBRACE = "{"
-    RBRACE = "{"
+    RBRACE = "}"
 	LBRACKET = "["
 	RBRACKET = "]"
 
@@ -47,6 +58,11 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	IMPORT   = "IMPORT"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
 )
 
 // to define and find token types for the given token(identifier)
@@ -58,6 +74,11 @@ var keywords = map[string]TokenType{
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"import": IMPORT,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
+	"throw":   THROW,
 }
 
 func LookupIdent(ident string) TokenType {